@@ -3,8 +3,12 @@ package api
 import (
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	
+	"mochibox-core/core"
 	"mochibox-core/crypto"
 	"mochibox-core/db"
 
@@ -24,9 +28,69 @@ func (s *Server) registerAccountRoutes(api *gin.RouterGroup) {
 		acc.POST("/change-password", s.handleAccountChangePassword)
 		acc.POST("/sign", s.handleAccountSign)
 		acc.POST("/verify-signature", s.handleAccountVerifySignature)
+		acc.GET("/identities", s.handleListIdentities)
+		acc.POST("/identities", s.handleCreateIdentity)
+		acc.POST("/identities/:id/activate", s.handleActivateIdentity)
 	}
 }
 
+func (s *Server) handleListIdentities(c *gin.Context) {
+	identities, err := s.AccountManager.ListIdentities()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list identities"})
+		return
+	}
+
+	var activeID uint
+	if profile, err := s.AccountManager.GetProfile(); err == nil {
+		activeID = profile.ActiveIdentityID
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities, "active_id": activeID})
+}
+
+func (s *Server) handleCreateIdentity(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if s.AccountManager.IsLocked() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
+		return
+	}
+
+	identity, err := s.AccountManager.CreateIdentity(req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, identity)
+}
+
+func (s *Server) handleActivateIdentity(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity id"})
+		return
+	}
+
+	if s.AccountManager.IsLocked() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
+		return
+	}
+
+	if err := s.AccountManager.SwitchIdentity(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, _ := s.AccountManager.GetProfile()
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "profile": profile})
+}
+
 func (s *Server) handleAccountSign(c *gin.Context) {
 	var req struct {
 		Message string `json:"message" binding:"required"` // Base64
@@ -90,27 +154,54 @@ func (s *Server) handleAccountVerifySignature(c *gin.Context) {
 	}
 
 	valid := s.AccountManager.Verify(data, sig, pubKey)
-	c.JSON(http.StatusOK, gin.H{"valid": valid})
+	if !valid {
+		c.JSON(http.StatusOK, gin.H{"valid": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": true, "signer": s.describeSigner(req.PublicKey)})
 }
 
 func (s *Server) handleAccountExport(c *gin.Context) {
     var req struct {
-        Password string `json:"password" binding:"required"`
+        Password   string `json:"password" binding:"required"`
+        Passphrase string `json:"passphrase"` // Required if the account uses a BIP39 passphrase
+        Shares     int    `json:"shares"`     // Optional: export as N Shamir shares
+        Threshold  int    `json:"threshold"`  // Shares needed to recover (K)
     }
     if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
     
+    if req.Shares > 0 {
+        if req.Threshold < 2 || req.Threshold > req.Shares {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Threshold must be between 2 and the number of shares"})
+            return
+        }
+        shares, err := s.AccountManager.ExportMnemonicShares(req.Password, req.Passphrase, req.Shares, req.Threshold)
+        if err != nil {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"shares": shares, "threshold": req.Threshold})
+        return
+    }
+    
     // We need to re-verify password against DB or current session?
     // Actually AccountManager.ExportMnemonic(password) logic would be safer
-    mnemonic, err := s.AccountManager.ExportMnemonic(req.Password)
+    mnemonic, err := s.AccountManager.ExportMnemonic(req.Password, req.Passphrase)
     if err != nil {
+        if errors.Is(err, core.ErrPassphraseRequired) || errors.Is(err, core.ErrInvalidPassphrase) {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "passphrase_required": true})
+            return
+        }
         c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
         return
     }
     
-    c.JSON(http.StatusOK, gin.H{"mnemonic": mnemonic})
+    // The passphrase is not part of the backup; the user must keep it separately
+    profile, _ := s.AccountManager.GetProfile()
+    c.JSON(http.StatusOK, gin.H{"mnemonic": mnemonic, "has_passphrase": profile != nil && profile.HasPassphrase})
 }
 
 func (s *Server) handleAccountChangePassword(c *gin.Context) {
@@ -165,7 +256,7 @@ func (s *Server) handleAccountStatus(c *gin.Context) {
 }
 
 func (s *Server) handleGenerateMnemonic(c *gin.Context) {
-    wallet, err := crypto.NewWallet()
+    wallet, err := crypto.NewWallet("")
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -175,9 +266,11 @@ func (s *Server) handleGenerateMnemonic(c *gin.Context) {
 
 func (s *Server) handleAccountInit(c *gin.Context) {
 	var req struct {
-		Mnemonic string `json:"mnemonic" binding:"required"`
-		Password string `json:"password" binding:"required"`
-		Name     string `json:"name" binding:"required"`
+		Mnemonic   string   `json:"mnemonic"`
+		Shares     []string `json:"shares"` // Recover from Shamir backup shares instead of a mnemonic
+		Passphrase string   `json:"passphrase"` // Optional BIP39 passphrase
+		Password   string   `json:"password" binding:"required"`
+		Name       string   `json:"name" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -185,7 +278,20 @@ func (s *Server) handleAccountInit(c *gin.Context) {
 		return
 	}
 
-	if err := s.AccountManager.InitAccount(req.Mnemonic, req.Password, req.Name); err != nil {
+	if req.Mnemonic == "" {
+		if len(req.Shares) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Mnemonic or backup shares required"})
+			return
+		}
+		mnemonic, err := crypto.CombineMnemonicShares(req.Shares)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to recover from shares: " + err.Error()})
+			return
+		}
+		req.Mnemonic = mnemonic
+	}
+
+	if err := s.AccountManager.InitAccount(req.Mnemonic, req.Password, req.Name, req.Passphrase); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to init account: " + err.Error()})
 		return
 	}
@@ -196,6 +302,7 @@ func (s *Server) handleAccountInit(c *gin.Context) {
 func (s *Server) handleAccountUnlock(c *gin.Context) {
 	var req struct {
 		Password   string `json:"password" binding:"required"`
+		Passphrase string `json:"passphrase"` // BIP39 passphrase, if the account uses one
 		RememberMe bool   `json:"remember_me"`
 	}
 
@@ -204,18 +311,26 @@ func (s *Server) handleAccountUnlock(c *gin.Context) {
 		return
 	}
 
-	if err := s.AccountManager.Unlock(req.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+	if err := s.AccountManager.Unlock(req.Password, req.Passphrase); err != nil {
+		switch {
+		case errors.Is(err, core.ErrPassphraseRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Passphrase required", "passphrase_required": true})
+		case errors.Is(err, core.ErrInvalidPassphrase):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passphrase", "passphrase_required": true})
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		}
 		return
 	}
     
     // Handle Remember Me
     if req.RememberMe {
-        // Obfuscate and save password (or better, save a derived token, but for now we save password for auto-unlock)
-        // Wait, storing password allows anyone with access to auth.lock to unlock.
-        // Yes, that's the tradeoff discussed.
-        if err := crypto.SaveAuthLock([]byte(req.Password), s.AccountManager.DataDir); err != nil {
+        // Save a derived unlock token (not the password) under the device key
+        var settings db.Settings
+        s.DB.First(&settings)
+        if err := s.AccountManager.SaveUnlockToken(req.Password, settings.RememberDuration()); err != nil {
             // Log warning but don't fail login
+            log.Printf("Failed to save auth lock: %v", err)
         }
     } else {
         // Clear if exists
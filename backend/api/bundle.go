@@ -0,0 +1,311 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"mochibox-core/crypto"
+	"mochibox-core/db"
+	"mochibox-core/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Manifests only list metadata; anything larger is not a bundle we made
+const maxBundleManifestSize = 4 * 1024 * 1024
+
+func (s *Server) registerBundleRoutes(api *gin.RouterGroup) {
+	bundles := api.Group("/bundles")
+	{
+		bundles.POST("", s.handleCreateBundle)
+		bundles.POST("/import", s.handleImportBundle)
+	}
+}
+
+// handleCreateBundle stores a signed manifest of several files on IPFS and
+// returns one link for all of them. With recipients the manifest is encrypted
+// and only they (and we) can open it.
+func (s *Server) handleCreateBundle(c *gin.Context) {
+	var req struct {
+		FileIDs    []uint   `json:"file_ids" binding:"required"`
+		Name       string   `json:"name"`
+		Recipients []string `json:"recipients"`  // Optional Ed25519 Hex keys
+		ContactIDs []uint   `json:"contact_ids"` // Recipients from the address book
+		ExpiresIn  int64    `json:"expires_in"`  // Seconds from now, 0 = never
+		NotBefore  int64    `json:"not_before"`  // Unix seconds, 0 = immediately
+		Note       string   `json:"note"`        // Kept in the share ledger only
+		Short      bool     `json:"short"`       // Return mochi://<cid> instead of the full link
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.FileIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files selected"})
+		return
+	}
+
+	if s.AccountManager.IsLocked() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
+		return
+	}
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get profile"})
+		return
+	}
+
+	var files []db.File
+	if err := s.DB.Where("id IN ?", req.FileIDs).Order("id").Find(&files).Error; err != nil || len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Files not found"})
+		return
+	}
+
+	payload := link.Payload{V: 1, Type: link.TypePublic, Name: req.Name, Bundle: true}
+	contactKeys, err := s.contactKeys(req.ContactIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recipients := crypto.ParsePubKeyList(append(req.Recipients, contactKeys...)...)
+	if err := applyValidity(&payload, req.ExpiresIn, req.NotBefore); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	manifest := link.NewManifest(req.Name, files)
+	for i, f := range files {
+		item, status, err := s.rewrapBundleItem(f, manifest.Items[i], recipients, profile.PublicKey)
+		if err != nil {
+			c.JSON(status, gin.H{"error": f.Name + ": " + err.Error()})
+			return
+		}
+		manifest.Items[i] = item
+	}
+	signed, err := link.SignManifest(manifest, s.AccountManager, profile.PublicKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign manifest: " + err.Error()})
+		return
+	}
+	var reader io.Reader = bytes.NewReader(signed)
+
+	if len(recipients) > 0 {
+		sessionKey := make([]byte, 32)
+		if _, err := rand.Read(sessionKey); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "RNG failed"})
+			return
+		}
+		// Seal to ourselves as well so the bundle stays readable here
+		keys, err := crypto.SealSessionKeyFor(sessionKey, crypto.ParsePubKeyList(append(recipients, profile.PublicKey)...))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Public Key: " + err.Error()})
+			return
+		}
+		meta, err := crypto.EncodeRecipientKeys(keys)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode recipients"})
+			return
+		}
+		encReader, err := crypto.NewEncryptReader(reader, sessionKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Encryption init failed"})
+			return
+		}
+		reader = encReader
+		payload.Type = link.TypePrivate
+		payload.Name = ""
+		payload.Params = &link.Params{EncryptedKey: meta}
+	}
+
+	cid, err := s.Node.AddFile(c.Request.Context(), reader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store manifest: " + err.Error()})
+		return
+	}
+	payload.CID = cid
+	s.holdPin(cid, db.PinBundle, cid)
+
+	var shareLink, shortCID string
+	if req.Short {
+		shareLink, shortCID, err = s.storeShortLink(c.Request.Context(), payload, profile.PublicKey)
+	} else {
+		shareLink, err = link.EncodeSigned(payload, s.AccountManager, profile.PublicKey)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build link"})
+		return
+	}
+	for _, f := range files {
+		s.recordIssuedShare(f, payload, strings.Join(recipients, ","), cid, shortCID, req.Note, true)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"link":     shareLink,
+		"cid":      cid,
+		"manifest": manifest,
+	})
+}
+
+// rewrapBundleItem wraps the content key of an encrypted item again for the
+// bundle recipients (and ourselves), the same way handleGrantAccess does for a
+// single file. Password items are only kept as such in bundles without
+// recipients; otherwise their derived key is wrapped and they become private.
+func (s *Server) rewrapBundleItem(file db.File, item link.Payload, recipients []string, self string) (link.Payload, int, error) {
+	if item.Type == link.TypePublic || (item.Type == link.TypePassword && len(recipients) == 0) {
+		return item, http.StatusOK, nil
+	}
+	if len(recipients) == 0 {
+		return item, http.StatusBadRequest, errors.New("private files need bundle recipients")
+	}
+
+	var contentKey []byte
+	switch item.Type {
+	case link.TypePrivate:
+		key, err := s.AccountManager.OpenSessionKey(file.EncryptionMeta)
+		if err != nil {
+			return item, http.StatusForbidden, errors.New("cannot open file key: " + err.Error())
+		}
+		contentKey = key
+	case link.TypePassword:
+		if file.SavedPassword == "" {
+			return item, http.StatusBadRequest, errors.New("password files need a saved password to be bundled for recipients")
+		}
+		password, err := s.openSavedPassword(file.SavedPassword)
+		if err != nil {
+			return item, http.StatusForbidden, errors.New("cannot open saved password")
+		}
+		key, err := crypto.DeriveKeyFromSalt(password, file.EncryptionMeta)
+		if err != nil {
+			return item, http.StatusInternalServerError, errors.New("key derivation failed")
+		}
+		contentKey = key
+	}
+
+	keys, err := crypto.SealSessionKeyFor(contentKey, crypto.ParsePubKeyList(append(recipients, self)...))
+	if err != nil {
+		return item, http.StatusBadRequest, errors.New("invalid public key: " + err.Error())
+	}
+	meta, err := crypto.EncodeRecipientKeys(keys)
+	if err != nil {
+		return item, http.StatusInternalServerError, errors.New("failed to encode recipients")
+	}
+	item.Type = link.TypePrivate
+	item.Params = &link.Params{EncryptedKey: meta}
+	return item, http.StatusOK, nil
+}
+
+// handleImportBundle fetches and verifies a bundle manifest and records one
+// Shared History row per item. Items are then pinned or downloaded one by one
+// through the usual shared endpoints.
+func (s *Server) handleImportBundle(c *gin.Context) {
+	var req struct {
+		Link string `json:"link" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	l, err := s.resolveLink(c.Request.Context(), req.Link)
+	if err != nil {
+		writeLinkError(c, l, err)
+		return
+	}
+	if !l.Bundle {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not a bundle link"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	reader, err := s.Node.GetFile(ctx, l.CID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch manifest: " + err.Error()})
+		return
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if l.EncryptionType() == "private" {
+		if s.AccountManager.IsLocked() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
+			return
+		}
+		sessionKey, err := s.AccountManager.OpenSessionKey(l.EncryptionMeta())
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: " + err.Error()})
+			return
+		}
+		decReader, err := crypto.NewDecryptReader(reader, sessionKey)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: " + err.Error()})
+			return
+		}
+		reader = decReader
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxBundleManifestSize+1))
+	if err != nil {
+		if errors.Is(err, crypto.ErrAuthFailed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read manifest: " + err.Error()})
+		return
+	}
+	if len(data) > maxBundleManifestSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Manifest too large"})
+		return
+	}
+
+	manifest, signedBy, err := link.OpenManifest(data, s.AccountManager)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// A signed link must come from the manifest's author
+	if l.SignedBy != "" && l.SignedBy != signedBy {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bundle signer mismatch"})
+		return
+	}
+
+	items := make([]db.SharedFile, 0, len(manifest.Items))
+	for _, item := range manifest.Items {
+		// Items inherit the bundle link's validity window
+		item.ExpiresAt, item.NotBefore = l.ExpiresAt, l.NotBefore
+		itemLink, _ := link.Encode(item)
+		row, err := s.saveSharedFile(db.SharedFile{
+			CID:            item.CID,
+			Name:           item.Name,
+			Size:           item.Size,
+			MimeType:       item.MimeType,
+			EncryptionType: item.EncryptionType(),
+			EncryptionMeta: item.EncryptionMeta(),
+			OriginalLink:   itemLink,
+			SignedBy:       signedBy,
+			BundleCID:      l.CID,
+			ExpiresAt:      l.Expiry(),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save history"})
+			return
+		}
+		items = append(items, row)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":      manifest.Name,
+		"cid":       l.CID,
+		"signed_by": signedBy,
+		"signer":    s.describeSigner(signedBy),
+		"items":     items,
+	})
+}
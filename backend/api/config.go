@@ -37,7 +37,10 @@ func (s *Server) handleGetConfig(c *gin.Context) {
 }
 
 func (s *Server) handleUpdateConfig(c *gin.Context) {
-	var req db.Settings
+	var req struct {
+		db.Settings
+		AnnounceNearby *bool `json:"announce_nearby"` // Left unchanged when omitted
+	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
@@ -49,6 +52,15 @@ func (s *Server) handleUpdateConfig(c *gin.Context) {
 	settings.AskPath = req.AskPath
 	settings.IpfsApiUrl = req.IpfsApiUrl
 	settings.UseEmbeddedNode = req.UseEmbeddedNode
+	if req.RememberDays > 0 {
+		settings.RememberDays = req.RememberDays
+	}
+	if req.TrashDays > 0 {
+		settings.TrashDays = req.TrashDays
+	}
+	if req.AnnounceNearby != nil {
+		settings.AnnounceNearby = *req.AnnounceNearby
+	}
 	
 	// If the user clears it, set to default
 	if settings.IpfsApiUrl == "" {
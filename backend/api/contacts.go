@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mochibox-core/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"gorm.io/gorm"
+)
+
+func (s *Server) registerContactRoutes(api *gin.RouterGroup) {
+	contacts := api.Group("/contacts")
+	{
+		contacts.GET("", s.handleListContacts)
+		contacts.POST("", s.handleCreateContact)
+		contacts.GET("/:id", s.handleGetContact)
+		contacts.PUT("/:id", s.handleUpdateContact)
+		contacts.DELETE("/:id", s.handleDeleteContact)
+	}
+}
+
+type contactRequest struct {
+	Name       string   `json:"name"`
+	PublicKey  string   `json:"public_key"`
+	PeerIDs    []string `json:"peer_ids"`
+	Addrs      []string `json:"addrs"`
+	TrustLevel string   `json:"trust_level"`
+	Notes      string   `json:"notes"`
+}
+
+// apply validates the request and copies it onto contact
+func (req contactRequest) apply(contact *db.Contact) error {
+	contact.Name = strings.TrimSpace(req.Name)
+	if contact.Name == "" {
+		return errors.New("Name required")
+	}
+
+	pub := strings.ToLower(strings.TrimSpace(req.PublicKey))
+	if raw, err := hex.DecodeString(pub); err != nil || len(raw) != 32 {
+		return errors.New("Invalid Public Key")
+	}
+	contact.PublicKey = pub
+
+	var peerIDs []string
+	for _, p := range req.PeerIDs {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := peer.Decode(p); err != nil {
+			return errors.New("Invalid peer ID: " + p)
+		}
+		peerIDs = append(peerIDs, p)
+	}
+	contact.PeerIDs = strings.Join(peerIDs, ",")
+
+	var addrs []string
+	for _, a := range req.Addrs {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if _, err := multiaddr.NewMultiaddr(a); err != nil {
+			return errors.New("Invalid address: " + a)
+		}
+		addrs = append(addrs, a)
+	}
+	contact.Addrs = strings.Join(addrs, ",")
+
+	switch req.TrustLevel {
+	case "":
+		contact.TrustLevel = db.TrustKnown
+	case db.TrustUntrusted, db.TrustKnown, db.TrustTrusted:
+		contact.TrustLevel = req.TrustLevel
+	default:
+		return errors.New("Invalid trust level")
+	}
+	contact.Notes = req.Notes
+	return nil
+}
+
+func (s *Server) handleListContacts(c *gin.Context) {
+	query := s.DB.Model(&db.Contact{})
+	if trust := c.Query("trust_level"); trust != "" {
+		query = query.Where("trust_level = ?", trust)
+	}
+	var contacts []db.Contact
+	if err := query.Order("name").Find(&contacts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contacts"})
+		return
+	}
+	c.JSON(http.StatusOK, contacts)
+}
+
+func (s *Server) handleGetContact(c *gin.Context) {
+	var contact db.Contact
+	if err := s.DB.First(&contact, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
+		return
+	}
+	c.JSON(http.StatusOK, contact)
+}
+
+func (s *Server) handleCreateContact(c *gin.Context) {
+	var req contactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var contact db.Contact
+	if err := req.apply(&contact); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	s.DB.Model(&db.Contact{}).Where("public_key = ?", contact.PublicKey).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Contact with this key already exists"})
+		return
+	}
+
+	contact.CreatedAt = time.Now()
+	if err := s.DB.Create(&contact).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save contact"})
+		return
+	}
+	c.JSON(http.StatusOK, contact)
+}
+
+func (s *Server) handleUpdateContact(c *gin.Context) {
+	var contact db.Contact
+	if err := s.DB.First(&contact, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
+		return
+	}
+	var req contactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(&contact); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	s.DB.Model(&db.Contact{}).Where("public_key = ? AND id <> ?", contact.PublicKey, contact.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Contact with this key already exists"})
+		return
+	}
+
+	if err := s.DB.Save(&contact).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save contact"})
+		return
+	}
+	c.JSON(http.StatusOK, contact)
+}
+
+func (s *Server) handleDeleteContact(c *gin.Context) {
+	if err := s.DB.Delete(&db.Contact{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete contact"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// contactKeys resolves contact IDs to their public keys
+func (s *Server) contactKeys(ids []uint) ([]string, error) {
+	var keys []string
+	for _, id := range ids {
+		var contact db.Contact
+		if err := s.DB.First(&contact, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("Contact %d not found", id)
+			}
+			return nil, err
+		}
+		keys = append(keys, contact.PublicKey)
+	}
+	return keys, nil
+}
+
+// parseContactIDs reads contact IDs from form values, skipping blanks
+func parseContactIDs(values []string) ([]uint, error) {
+	var ids []uint
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("Invalid contact ID: " + v)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// describeSigner tells the user who signed a link: the matching contact's name
+// and trust level, or "unknown" / "unsigned" when there is none
+func (s *Server) describeSigner(pubKeyHex string) gin.H {
+	if pubKeyHex == "" {
+		return gin.H{"status": "unsigned"}
+	}
+	if profile, err := s.AccountManager.GetProfile(); err == nil && strings.EqualFold(profile.PublicKey, pubKeyHex) {
+		return gin.H{"status": "self", "name": profile.Name}
+	}
+	var contact db.Contact
+	if err := s.DB.Where("public_key = ?", strings.ToLower(pubKeyHex)).First(&contact).Error; err != nil {
+		return gin.H{"status": "unknown", "public_key": pubKeyHex}
+	}
+	return gin.H{
+		"status":     contact.TrustLevel,
+		"contact_id": contact.ID,
+		"name":       contact.Name,
+		"public_key": contact.PublicKey,
+	}
+}
@@ -0,0 +1,549 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mochibox-core/db"
+	"mochibox-core/link"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	feedCheckInterval = 15 * time.Minute
+	// IPNS records expire, so feeds are republished well before their lifetime ends
+	feedLifetime       = 48 * time.Hour
+	feedRepublishAge   = 12 * time.Hour
+	feedResolveTimeout = 60 * time.Second
+)
+
+var errFeedLocked = errors.New("Account locked")
+
+func (s *Server) registerFeedRoutes(api *gin.RouterGroup) {
+	feed := api.Group("/feed")
+	{
+		feed.GET("", s.handleGetFeed)
+		feed.POST("/items", s.handleAddFeedItem)
+		feed.PUT("/items/:id", s.handleUpdateFeedItem)
+		feed.DELETE("/items/:id", s.handleDeleteFeedItem)
+		feed.POST("/publish", s.handlePublishFeed)
+	}
+
+	follows := api.Group("/follows")
+	{
+		follows.GET("", s.handleListFollows)
+		follows.POST("", s.handleAddFollow)
+		follows.DELETE("/:id", s.handleDeleteFollow)
+		follows.POST("/:id/refresh", s.handleRefreshFollow)
+	}
+
+	subs := api.Group("/subscriptions")
+	{
+		subs.GET("", s.handleListSubscriptions)
+		subs.POST("/:id/seen", s.handleMarkSubscriptionSeen)
+		subs.POST("/:id/pin", s.handlePinSubscription)
+	}
+}
+
+// feedKeyName names the node keystore entry holding an identity's feed key,
+// which is derived from the seed so the feed survives a new IPFS node
+func feedKeyName(pubKeyHex string) string {
+	return "mochibox-feed-" + strings.ToLower(pubKeyHex)[:16]
+}
+
+// runFeedWatcher polls followed feeds and keeps our own feed's IPNS record alive
+func (s *Server) runFeedWatcher() {
+	ticker := time.NewTicker(feedCheckInterval)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		if s.Node == nil {
+			continue
+		}
+		s.refreshAllFollows()
+		s.republishFeedIfDue()
+	}
+}
+
+func (s *Server) refreshAllFollows() {
+	var follows []db.Follow
+	if err := s.DB.Find(&follows).Error; err != nil {
+		return
+	}
+	for i := range follows {
+		ctx, cancel := context.WithTimeout(context.Background(), feedResolveTimeout)
+		if _, err := s.refreshFollow(ctx, &follows[i]); err != nil {
+			log.Printf("Feed: failed to refresh %s: %v", follows[i].Name, err)
+		}
+		cancel()
+	}
+}
+
+func (s *Server) republishFeedIfDue() {
+	if s.AccountManager.IsLocked() {
+		return
+	}
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		return
+	}
+	var pub db.FeedPublication
+	if err := s.DB.First(&pub, "owner = ?", strings.ToLower(profile.PublicKey)).Error; err != nil {
+		// Never published; publishing is opt-in
+		return
+	}
+	if time.Since(pub.PublishedAt) < feedRepublishAge {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), feedResolveTimeout)
+	defer cancel()
+	if _, err := s.publishFeed(ctx); err != nil {
+		log.Printf("Feed: republish failed: %v", err)
+	}
+}
+
+// buildFeed lists the public files the active identity has put in its feed
+func (s *Server) buildFeed(owner, ownerName string) (link.Feed, error) {
+	var entries []db.FeedEntry
+	if err := s.DB.Where("owner = ?", owner).Order("created_at desc").Find(&entries).Error; err != nil {
+		return link.Feed{}, err
+	}
+	f := link.Feed{V: 1, Owner: ownerName, Items: []link.FeedItem{}, UpdatedAt: time.Now().UTC()}
+	for _, entry := range entries {
+		var file db.File
+		if err := s.DB.First(&file, entry.FileID).Error; err != nil || file.EncryptionType != "public" {
+			continue
+		}
+		f.Items = append(f.Items, link.FeedItem{
+			CID:         file.CID,
+			Name:        file.Name,
+			Size:        file.Size,
+			MimeType:    file.MimeType,
+			Description: entry.Description,
+			AddedAt:     entry.CreatedAt.UTC(),
+		})
+	}
+	return f, nil
+}
+
+// publishFeed signs the feed, stores it on IPFS and points the identity's
+// IPNS name at it
+func (s *Server) publishFeed(ctx context.Context) (db.FeedPublication, error) {
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil || s.AccountManager.IsLocked() {
+		return db.FeedPublication{}, errFeedLocked
+	}
+	owner := strings.ToLower(profile.PublicKey)
+
+	f, err := s.buildFeed(owner, profile.Name)
+	if err != nil {
+		return db.FeedPublication{}, err
+	}
+	signed, err := link.SignFeed(f, s.AccountManager, profile.PublicKey)
+	if err != nil {
+		return db.FeedPublication{}, err
+	}
+
+	feedCID, err := s.Node.AddFile(ctx, bytes.NewReader(signed))
+	if err != nil {
+		return db.FeedPublication{}, fmt.Errorf("failed to store feed: %w", err)
+	}
+	if err := s.Node.Pin(ctx, feedCID); err != nil {
+		return db.FeedPublication{}, fmt.Errorf("failed to pin feed: %w", err)
+	}
+
+	keyName := feedKeyName(owner)
+	feedKey, err := s.AccountManager.FeedKey(owner)
+	if err != nil {
+		return db.FeedPublication{}, fmt.Errorf("failed to derive feed key: %w", err)
+	}
+	if _, err := s.Node.ImportKey(ctx, keyName, feedKey); err != nil {
+		return db.FeedPublication{}, fmt.Errorf("failed to import feed key: %w", err)
+	}
+	name, err := s.Node.PublishName(ctx, feedCID, keyName, feedLifetime)
+	if err != nil {
+		return db.FeedPublication{}, fmt.Errorf("failed to publish feed: %w", err)
+	}
+
+	s.holdPin(feedCID, db.PinFeed, owner)
+	var previous db.FeedPublication
+	if s.DB.First(&previous, "owner = ?", owner).Error == nil && previous.CID != "" && previous.CID != feedCID {
+		if err := s.releasePin(ctx, previous.CID, db.PinFeed, owner); err != nil {
+			log.Printf("Feed: failed to unpin previous feed %s: %v", previous.CID, err)
+		}
+	}
+	pub := db.FeedPublication{Owner: owner, Name: name, CID: feedCID, PublishedAt: time.Now()}
+	return pub, s.DB.Save(&pub).Error
+}
+
+func (s *Server) handleGetFeed(c *gin.Context) {
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No account"})
+		return
+	}
+	owner := strings.ToLower(profile.PublicKey)
+
+	var entries []db.FeedEntry
+	if err := s.DB.Where("owner = ?", owner).Order("created_at desc").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return
+	}
+	items := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		var file db.File
+		s.DB.First(&file, entry.FileID)
+		items = append(items, gin.H{"entry": entry, "file": file})
+	}
+
+	var pub *db.FeedPublication
+	var p db.FeedPublication
+	if s.DB.First(&p, "owner = ?", owner).Error == nil {
+		pub = &p
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "publication": pub})
+}
+
+func (s *Server) handleAddFeedItem(c *gin.Context) {
+	var req struct {
+		FileID      uint   `json:"file_id" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No account"})
+		return
+	}
+
+	var file db.File
+	if err := s.DB.First(&file, req.FileID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if file.EncryptionType != "public" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only public files can be listed in a feed"})
+		return
+	}
+
+	entry := db.FeedEntry{Owner: strings.ToLower(profile.PublicKey), FileID: file.ID}
+	if err := s.DB.Where(entry).FirstOrInit(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add feed item"})
+		return
+	}
+	entry.Description = strings.TrimSpace(req.Description)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	if err := s.DB.Save(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add feed item"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+func (s *Server) handleUpdateFeedItem(c *gin.Context) {
+	var req struct {
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No account"})
+		return
+	}
+
+	// Only entries of the active identity's feed
+	var entry db.FeedEntry
+	if err := s.DB.Where("owner = ?", strings.ToLower(profile.PublicKey)).First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed item not found"})
+		return
+	}
+	entry.Description = strings.TrimSpace(req.Description)
+	if err := s.DB.Save(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update feed item"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+func (s *Server) handleDeleteFeedItem(c *gin.Context) {
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No account"})
+		return
+	}
+
+	res := s.DB.Where("owner = ?", strings.ToLower(profile.PublicKey)).Delete(&db.FeedEntry{}, c.Param("id"))
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete feed item"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed item not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// handlePublishFeed publishes the current feed under the identity's IPNS name
+func (s *Server) handlePublishFeed(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*feedResolveTimeout)
+	defer cancel()
+	pub, err := s.publishFeed(ctx)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errFeedLocked) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pub)
+}
+
+// refreshFollow resolves a followed feed and records items not seen before.
+// The first verified signer is remembered; feeds signed by anyone else are refused.
+func (s *Server) refreshFollow(ctx context.Context, f *db.Follow) (int, error) {
+	now := time.Now()
+	f.LastChecked = &now
+	created, err := s.fetchFollow(ctx, f)
+	f.LastError = ""
+	if err != nil {
+		f.LastError = err.Error()
+	}
+	if serr := s.DB.Save(f).Error; err == nil {
+		err = serr
+	}
+	return created, err
+}
+
+func (s *Server) fetchFollow(ctx context.Context, f *db.Follow) (int, error) {
+	feedCID, err := s.Node.ResolveName(ctx, f.Name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve feed: %w", err)
+	}
+	if feedCID == f.CID {
+		return 0, nil
+	}
+
+	reader, err := s.Node.GetFile(ctx, feedCID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, link.MaxFeedSize+1))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read feed: %w", err)
+	}
+	if len(data) > link.MaxFeedSize {
+		return 0, errors.New("feed too large")
+	}
+
+	feed, signedBy, err := link.OpenFeed(data, s.AccountManager)
+	if err != nil {
+		return 0, err
+	}
+	if f.PublicKey != "" && f.PublicKey != signedBy {
+		return 0, fmt.Errorf("feed signer changed to %s", signedBy)
+	}
+
+	created := 0
+	for _, item := range feed.Items {
+		row := db.SubscriptionItem{FollowID: f.ID, CID: item.CID}
+		res := s.DB.Where(row).Attrs(db.SubscriptionItem{
+			Name:        item.Name,
+			Size:        item.Size,
+			MimeType:    item.MimeType,
+			Description: item.Description,
+			AddedAt:     item.AddedAt,
+			CreatedAt:   time.Now(),
+		}).FirstOrCreate(&row)
+		if res.Error != nil {
+			return created, res.Error
+		}
+		created += int(res.RowsAffected)
+	}
+
+	f.PublicKey, f.CID, f.Owner = signedBy, feedCID, feed.Owner
+	return created, nil
+}
+
+func (s *Server) handleListFollows(c *gin.Context) {
+	var follows []db.Follow
+	if err := s.DB.Order("created_at desc").Find(&follows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch follows"})
+		return
+	}
+	result := make([]gin.H, 0, len(follows))
+	for _, f := range follows {
+		var unseen int64
+		s.DB.Model(&db.SubscriptionItem{}).Where("follow_id = ? AND seen = ?", f.ID, false).Count(&unseen)
+		result = append(result, gin.H{"follow": f, "signer": s.describeSigner(f.PublicKey), "unseen": unseen})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) handleAddFollow(c *gin.Context) {
+	var req struct {
+		Name  string `json:"name" binding:"required"` // IPNS name, with or without /ipns/
+		Label string `json:"label"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimSpace(req.Name), "/ipns/")
+	if _, err := peer.Decode(name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed name"})
+		return
+	}
+
+	var count int64
+	s.DB.Model(&db.Follow{}).Where("name = ?", name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already following this feed"})
+		return
+	}
+	f := db.Follow{Name: name, Label: strings.TrimSpace(req.Label), CreatedAt: time.Now()}
+	if err := s.DB.Create(&f).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow feed"})
+		return
+	}
+
+	// First resolve in the background; IPNS lookups can take a while
+	go func(f db.Follow) {
+		ctx, cancel := context.WithTimeout(context.Background(), feedResolveTimeout)
+		defer cancel()
+		if _, err := s.refreshFollow(ctx, &f); err != nil {
+			log.Printf("Feed: failed to refresh %s: %v", f.Name, err)
+		}
+	}(f)
+
+	c.JSON(http.StatusOK, f)
+}
+
+func (s *Server) handleDeleteFollow(c *gin.Context) {
+	var f db.Follow
+	if err := s.DB.First(&f, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Follow not found"})
+		return
+	}
+	s.DB.Where("follow_id = ?", f.ID).Delete(&db.SubscriptionItem{})
+	if err := s.DB.Delete(&f).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete follow"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+func (s *Server) handleRefreshFollow(c *gin.Context) {
+	var f db.Follow
+	if err := s.DB.First(&f, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Follow not found"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), feedResolveTimeout)
+	defer cancel()
+	created, err := s.refreshFollow(ctx, &f)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "follow": f})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"follow": f, "new_items": created})
+}
+
+// handleListSubscriptions lists files from followed feeds, newest first
+func (s *Server) handleListSubscriptions(c *gin.Context) {
+	query := s.DB.Model(&db.SubscriptionItem{})
+	if followID := c.Query("follow_id"); followID != "" {
+		query = query.Where("follow_id = ?", followID)
+	}
+	if c.Query("unseen") == "true" {
+		query = query.Where("seen = ?", false)
+	}
+	var items []db.SubscriptionItem
+	if err := query.Order("added_at desc").Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscriptions"})
+		return
+	}
+
+	follows := make(map[uint]db.Follow)
+	result := make([]gin.H, 0, len(items))
+	for _, item := range items {
+		f, ok := follows[item.FollowID]
+		if !ok {
+			s.DB.First(&f, item.FollowID)
+			follows[item.FollowID] = f
+		}
+		result = append(result, gin.H{
+			"item":   item,
+			"follow": gin.H{"id": f.ID, "name": f.Name, "label": f.Label, "owner": f.Owner},
+			"signer": s.describeSigner(f.PublicKey),
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) handleMarkSubscriptionSeen(c *gin.Context) {
+	res := s.DB.Model(&db.SubscriptionItem{}).Where("id = ?", c.Param("id")).Update("seen", true)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "seen"})
+}
+
+// handlePinSubscription pins a feed item and adds it to Shared History and My Files
+func (s *Server) handlePinSubscription(c *gin.Context) {
+	var item db.SubscriptionItem
+	if err := s.DB.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if err := s.Node.Pin(c.Request.Context(), item.CID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin: " + err.Error()})
+		return
+	}
+
+	payload := link.Payload{V: 1, CID: item.CID, Name: item.Name, Size: item.Size, Type: link.TypePublic, MimeType: item.MimeType}
+	itemLink, _ := link.Encode(payload)
+	shared, err := s.saveSharedFile(db.SharedFile{
+		CID:            item.CID,
+		Name:           item.Name,
+		Size:           item.Size,
+		MimeType:       item.MimeType,
+		EncryptionType: "public",
+		OriginalLink:   itemLink,
+		// The feed was signed, but this rebuilt link is not, so nothing vouches for it
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save history"})
+		return
+	}
+	s.addPinnedFile(c.Request.Context(), item.CID, "public", "", "")
+	s.DB.Model(&item).Update("seen", true)
+
+	c.JSON(http.StatusOK, gin.H{"status": "pinned", "cid": item.CID, "shared": shared})
+}
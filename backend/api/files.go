@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,12 +11,12 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
-	"encoding/hex"
 	"encoding/base64"
 	"crypto/rand"
 	"archive/zip"
 
 	"mochibox-core/db"
+	"mochibox-core/link"
 	"mochibox-core/crypto"
 	"mochibox-core/core"
 
@@ -37,6 +38,10 @@ func (s *Server) registerFileRoutes(db *gorm.DB) {
 		})
         api.POST("/:id/download", s.handleDownloadToDisk)
         api.POST("/:id/reveal", s.handleRevealPassword)
+        api.POST("/:id/grant", s.handleGrantAccess)
+        api.POST("/:id/link", s.handleGenerateLink)
+        api.POST("/:id/package", s.handleExportPackage)
+        api.POST("/move", s.handleMoveFiles)
         api.POST("/download/shared", s.handleDownloadShared)
 		api.POST("/sync", func(c *gin.Context) {
 			s.handleSyncFiles(c, db)
@@ -63,6 +68,21 @@ func ensureUniquePath(path string) string {
     }
 }
 
+// writeDownload copies reader to dstPath. A failed copy (e.g. a chunk that does not
+// authenticate) removes the partial file instead of leaving garbage behind.
+func writeDownload(dstPath string, reader io.Reader) error {
+    dst, err := os.Create(dstPath)
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(dst, reader); err != nil {
+        dst.Close()
+        os.Remove(dstPath)
+        return err
+    }
+    return dst.Close()
+}
+
 func (s *Server) handleDownloadToDisk(c *gin.Context) {
     id := c.Param("id")
     var req struct {
@@ -77,18 +97,8 @@ func (s *Server) handleDownloadToDisk(c *gin.Context) {
         return
     }
     
-    var settings db.Settings
-    s.DB.First(&settings)
-    
-    // Fallback if not set
-    saveDir := settings.DownloadPath
-    if saveDir == "" {
-        home, _ := os.UserHomeDir()
-        saveDir = filepath.Join(home, "Downloads")
-    }
-    
-    // Ensure dir exists
-    if err := os.MkdirAll(saveDir, 0755); err != nil {
+    saveDir, err := s.downloadDir()
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create download directory"})
         return
     }
@@ -112,23 +122,8 @@ func (s *Server) handleDownloadToDisk(c *gin.Context) {
         
         // If password not provided, try to use saved password
         if password == "" && file.SavedPassword != "" {
-            if s.AccountManager.Wallet != nil {
-                // Decrypt saved password
-                encPass, err := base64.StdEncoding.DecodeString(file.SavedPassword)
-                if err == nil {
-                     // Convert Ed25519 keys to Curve25519 for Box
-                     curvePub, _ := crypto.Ed25519PublicKeyToCurve25519(s.AccountManager.Wallet.PublicKey)
-                     curvePriv, _ := crypto.Ed25519PrivateKeyToCurve25519(s.AccountManager.Wallet.PrivateKey)
-                     var pubKey [32]byte
-                     var privKey [32]byte
-                     copy(pubKey[:], curvePub)
-                     copy(privKey[:], curvePriv)
-                     
-                     decrypted, err := crypto.DecryptBoxAnonymous(encPass, &pubKey, &privKey)
-                     if err == nil {
-                         password = string(decrypted)
-                     }
-                }
+            if decrypted, err := s.openSavedPassword(file.SavedPassword); err == nil {
+                password = decrypted
             }
         }
 
@@ -137,9 +132,12 @@ func (s *Server) handleDownloadToDisk(c *gin.Context) {
             return
         }
 
-        salt, _ := hex.DecodeString(file.EncryptionMeta)
-        key := crypto.DeriveKey(password, salt)
-        decReader, err := crypto.NewAESCTRDecrypter(reader, key)
+        key, err := crypto.DeriveKeyFromSalt(password, file.EncryptionMeta)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid salt in DB"})
+            return
+        }
+        decReader, err := crypto.NewDecryptReader(reader, key)
         if err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Decryption init failed"})
             return
@@ -151,13 +149,12 @@ func (s *Server) handleDownloadToDisk(c *gin.Context) {
              c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
              return
          }
-         encKey, _ := base64.StdEncoding.DecodeString(file.EncryptionMeta)
-         sessionKey, err := s.AccountManager.DecryptBox(encKey)
+         sessionKey, err := s.AccountManager.OpenSessionKey(file.EncryptionMeta)
          if err != nil {
              c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to decrypt session key"})
              return
          }
-         decReader, err := crypto.NewAESCTRDecrypter(reader, sessionKey)
+         decReader, err := crypto.NewDecryptReader(reader, sessionKey)
          if err != nil {
              c.JSON(http.StatusInternalServerError, gin.H{"error": "Decryption init failed"})
              return
@@ -165,15 +162,12 @@ func (s *Server) handleDownloadToDisk(c *gin.Context) {
          reader = decReader
     }
     
-    dst, err := os.Create(dstPath)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file: " + err.Error()})
-        return
-    }
-    defer dst.Close()
-    
-    if _, err := io.Copy(dst, reader); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write file: " + err.Error()})
+    if err := writeDownload(dstPath, reader); err != nil {
+        status := http.StatusInternalServerError
+        if errors.Is(err, crypto.ErrAuthFailed) {
+            status = http.StatusForbidden
+        }
+        c.JSON(status, gin.H{"error": "Failed to write file: " + err.Error()})
         return
     }
     
@@ -193,32 +187,173 @@ func (s *Server) handleRevealPassword(c *gin.Context) {
         return
     }
     
-    if s.AccountManager.Wallet == nil {
+    if s.AccountManager.IsLocked() {
         c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
         return
     }
     
-    encPass, err := base64.StdEncoding.DecodeString(file.SavedPassword)
+    password, err := s.openSavedPassword(file.SavedPassword)
     if err != nil {
-         c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid saved password"})
-         return
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Decryption failed"})
+        return
     }
     
-    // Convert Ed25519 keys to Curve25519 for Box
-    curvePub, _ := crypto.Ed25519PublicKeyToCurve25519(s.AccountManager.Wallet.PublicKey)
-    curvePriv, _ := crypto.Ed25519PrivateKeyToCurve25519(s.AccountManager.Wallet.PrivateKey)
-    var pubKey [32]byte
-    var privKey [32]byte
-    copy(pubKey[:], curvePub)
-    copy(privKey[:], curvePriv)
-    
-    decrypted, err := crypto.DecryptBoxAnonymous(encPass, &pubKey, &privKey)
+    c.JSON(http.StatusOK, gin.H{"password": password})
+}
+
+// openSavedPassword decrypts a saved password with whichever identity it
+// was saved under
+func (s *Server) openSavedPassword(saved string) (string, error) {
+    encPass, err := base64.StdEncoding.DecodeString(saved)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Decryption failed"})
+        return "", err
+    }
+    decrypted, err := s.AccountManager.DecryptBox(encPass)
+    if err != nil {
+        return "", err
+    }
+    return string(decrypted), nil
+}
+
+// handleGrantAccess gives an additional public key access to an encrypted file by
+// wrapping its content key again. Nothing is re-encrypted or re-uploaded; the
+// response carries a Mochi link addressed to the new recipient.
+func (s *Server) handleGrantAccess(c *gin.Context) {
+    id := c.Param("id")
+    var req struct {
+        PublicKey string `json:"public_key"` // Recipient Ed25519 Hex
+        ContactID uint   `json:"contact_id"` // Or a recipient from the address book
+        Password  string `json:"password"`   // Password files without a saved password
+        Note      string `json:"note"`       // Kept in the share ledger only
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
-    
-    c.JSON(http.StatusOK, gin.H{"password": string(decrypted)})
+    if req.ContactID != 0 {
+        keys, err := s.contactKeys([]uint{req.ContactID})
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        req.PublicKey = keys[0]
+    }
+
+    var file db.File
+    if err := s.DB.First(&file, id).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+        return
+    }
+
+    if s.AccountManager.IsLocked() {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
+        return
+    }
+
+    recipientKeys := crypto.ParsePubKeyList(req.PublicKey)
+    if len(recipientKeys) != 1 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one public key required"})
+        return
+    }
+
+    // Recover the key the content is encrypted with
+    var contentKey []byte
+    switch file.EncryptionType {
+    case "private":
+        key, err := s.AccountManager.OpenSessionKey(file.EncryptionMeta)
+        if err != nil {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: " + err.Error()})
+            return
+        }
+        contentKey = key
+    case "password":
+        password := req.Password
+        if password == "" && file.SavedPassword != "" {
+            if decrypted, err := s.openSavedPassword(file.SavedPassword); err == nil {
+                password = decrypted
+            }
+        }
+        if password == "" {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Password required"})
+            return
+        }
+        key, err := crypto.DeriveKeyFromSalt(password, file.EncryptionMeta)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid salt in DB"})
+            return
+        }
+        // A wrong password would yield a link nobody can open
+        if err := s.checkContentKey(c.Request.Context(), file.CID, key); err != nil {
+            if errors.Is(err, crypto.ErrAuthFailed) {
+                c.JSON(http.StatusUnauthorized, gin.H{"error": "Wrong password"})
+                return
+            }
+            c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify password: " + err.Error()})
+            return
+        }
+        contentKey = key
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Only password or private files can be granted"})
+        return
+    }
+
+    granted, err := crypto.SealSessionKeyFor(contentKey, recipientKeys)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Public Key: " + err.Error()})
+        return
+    }
+
+    // Private files remember the new recipient so later links and lookups include it
+    if file.EncryptionType == "private" {
+        recipients, err := crypto.DecodeRecipientKeys(file.EncryptionMeta)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid metadata"})
+            return
+        }
+        exists := false
+        for _, r := range recipients {
+            if strings.EqualFold(r.PubKey, granted[0].PubKey) {
+                exists = true
+                break
+            }
+        }
+        if !exists {
+            meta, err := crypto.EncodeRecipientKeys(append(recipients, granted[0]))
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode recipients"})
+                return
+            }
+            file.EncryptionMeta = meta
+            file.RecipientPubKey = strings.Join(crypto.ParsePubKeyList(file.RecipientPubKey, granted[0].PubKey), ",")
+            if err := s.DB.Save(&file).Error; err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save metadata"})
+                return
+            }
+        }
+    }
+
+    // The recipient's link only carries their own wrapped key
+    grantMeta, err := crypto.EncodeRecipientKeys(granted)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode recipients"})
+        return
+    }
+    payload := link.ForFile(file)
+    payload.Type = link.TypePrivate
+    payload.Params = &link.Params{EncryptedKey: grantMeta}
+    shareLink, err := link.Encode(payload)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build link"})
+        return
+    }
+    s.recordIssuedShare(file, payload, granted[0].PubKey, "", "", req.Note, false)
+
+    c.JSON(http.StatusOK, gin.H{
+        "link":       shareLink,
+        "payload":    payload,
+        "public_key": granted[0].PubKey,
+        "file":       file,
+    })
 }
 
 func (s *Server) handleDownloadShared(c *gin.Context) {
@@ -273,25 +408,33 @@ func (s *Server) handleDownloadShared(c *gin.Context) {
                  c.JSON(http.StatusUnauthorized, gin.H{"error": "Password required"})
                  return
             }
-            salt, _ := hex.DecodeString(file.EncryptionMeta)
-            key := crypto.DeriveKey(req.Password, salt)
-            decReader, err := crypto.NewAESCTRDecrypter(reader, key)
-            if err == nil {
-                reader = decReader
+            key, err := crypto.DeriveKeyFromSalt(req.Password, file.EncryptionMeta)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid salt in DB"})
+                return
+            }
+            decReader, err := crypto.NewDecryptReader(reader, key)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Decryption init failed"})
+                return
             }
+            reader = decReader
         } else if file.EncryptionType == "private" {
              if s.AccountManager.IsLocked() {
                  c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
                  return
              }
-             encKey, _ := base64.StdEncoding.DecodeString(file.EncryptionMeta)
-             sessionKey, err := s.AccountManager.DecryptBox(encKey)
-             if err == nil {
-                 decReader, err := crypto.NewAESCTRDecrypter(reader, sessionKey)
-                 if err == nil {
-                     reader = decReader
-                 }
+             sessionKey, err := s.AccountManager.OpenSessionKey(file.EncryptionMeta)
+             if err != nil {
+                 c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to decrypt session key"})
+                 return
+             }
+             decReader, err := crypto.NewDecryptReader(reader, sessionKey)
+             if err != nil {
+                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Decryption init failed"})
+                 return
              }
+             reader = decReader
         }
     } else {
         // Not in DB? Try to use params if provided (TODO: Frontend needs to send salt/meta)
@@ -311,15 +454,12 @@ func (s *Server) handleDownloadShared(c *gin.Context) {
         // We should probably fail if we can't decrypt, rather than saving garbage.
     }
 
-    dst, err := os.Create(dstPath)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file: " + err.Error()})
-        return
-    }
-    defer dst.Close()
-    
-    if _, err := io.Copy(dst, reader); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write file: " + err.Error()})
+    if err := writeDownload(dstPath, reader); err != nil {
+        status := http.StatusInternalServerError
+        if errors.Is(err, crypto.ErrAuthFailed) {
+            status = http.StatusForbidden
+        }
+        c.JSON(status, gin.H{"error": "Failed to write file: " + err.Error()})
         return
     }
     
@@ -348,6 +488,15 @@ func (s *Server) handleUpload(c *gin.Context, database *gorm.DB) {
 		return
 	}
 
+	folderID, err := parseFolderID(c.PostForm("folder_id"))
+	if err == nil && !s.folderExists(folderID) {
+		err = errors.New("Folder not found")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	paths := form.Value["paths[]"]
 	encType := c.PostForm("encryption_type")
 	if encType == "" { encType = "public" }
@@ -488,6 +637,14 @@ func (s *Server) handleUpload(c *gin.Context, database *gorm.DB) {
 
 		// Encryption Logic
 		savePassword := c.PostForm("save_password") == "true"
+
+		// Name, type and size travel inside the ciphertext for encrypted uploads
+		envelope := &crypto.FileMetadata{
+			Name:      fileName,
+			MimeType:  mimeType,
+			Size:      fileSize,
+			CreatedAt: time.Now(),
+		}
 		
 		if encType == "password" {
 			password := c.PostForm("password")
@@ -506,39 +663,42 @@ func (s *Server) handleUpload(c *gin.Context, database *gorm.DB) {
 				}
 			}
 			
-			salt, err := crypto.GenerateSalt(16)
+			kdfSalt, err := crypto.NewKDFSalt()
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate salt"})
 				return
 			}
 			
-			key := crypto.DeriveKey(password, salt)
-			r, err := crypto.NewAESCTRReader(reader, key)
+			key, err := crypto.DeriveKeyFromSalt(password, kdfSalt)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Key derivation failed"})
+				return
+			}
+			r, err := crypto.NewEncryptReaderWithMetadata(reader, key, envelope)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Encryption init failed"})
 				return
 			}
 			
 			reader = r
-			encryptionMeta = hex.EncodeToString(salt)
+			encryptionMeta = kdfSalt
 			
 		} else if encType == "private" {
-			receiverPubHex := c.PostForm("receiver_pub_key")
-			if receiverPubHex == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Receiver Public Key required"})
+			// Recipients: repeated receiver_pub_keys[] and/or a comma separated receiver_pub_key,
+			// plus address book entries by contact_ids[] / contact_id
+			contactIDs, err := parseContactIDs(append(form.Value["contact_ids[]"], c.PostForm("contact_id")))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			recipientPubKey = receiverPubHex
-			
-			edPub, err := hex.DecodeString(receiverPubHex)
-			if err != nil || len(edPub) != 32 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Public Key"})
+			contactKeys, err := s.contactKeys(contactIDs)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			
-			curvePub, err := crypto.Ed25519PublicKeyToCurve25519(edPub)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to convert key: " + err.Error()})
+			receivers := crypto.ParsePubKeyList(append(append(form.Value["receiver_pub_keys[]"], c.PostForm("receiver_pub_key")), contactKeys...)...)
+			if len(receivers) == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Receiver Public Key required"})
 				return
 			}
 			
@@ -548,7 +708,22 @@ func (s *Server) handleUpload(c *gin.Context, database *gorm.DB) {
 				return
 			}
 			
-			r, err := crypto.NewAESCTRReader(reader, sessionKey)
+			// Wrap the session key once per recipient, plus once for ourselves so the
+			// uploader can still open their own "My Files" entry. Without our key
+			// the upload would be unreadable here, so a locked account is refused.
+			selfKey, err := s.AccountManager.PublicKeyHex()
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked: unlock to upload privately"})
+				return
+			}
+			sealTo := crypto.ParsePubKeyList(append(receivers, selfKey)...)
+			recipients, err := crypto.SealSessionKeyFor(sessionKey, sealTo)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Public Key: " + err.Error()})
+				return
+			}
+			
+			r, err := crypto.NewEncryptReaderWithMetadata(reader, sessionKey, envelope)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Encryption init failed"})
 				return
@@ -556,13 +731,12 @@ func (s *Server) handleUpload(c *gin.Context, database *gorm.DB) {
 			
 			reader = r
 			
-			encKey, err := crypto.EncryptSessionKey(curvePub, sessionKey)
+			encryptionMeta, err = crypto.EncodeRecipientKeys(recipients)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt session key"})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode recipients"})
 				return
 			}
-			
-			encryptionMeta = base64.StdEncoding.EncodeToString(encKey)
+			recipientPubKey = strings.Join(receivers, ",")
 		}
 
 		if !useLocal {
@@ -599,7 +773,9 @@ func (s *Server) handleUpload(c *gin.Context, database *gorm.DB) {
 		EncryptionMeta: encryptionMeta,
 		SavedPassword:  savedPassword,
 		RecipientPubKey: recipientPubKey,
+		SealedMeta:     encType == "password" || encType == "private",
 		IsFolder:       isFolderDB,
+		FolderID:       folderID,
 		CreatedAt:      time.Now(),
 	}
 
@@ -608,17 +784,86 @@ func (s *Server) handleUpload(c *gin.Context, database *gorm.DB) {
 		return
 	}
 
+	// Tell private recipients through their pubsub inbox
+	if encType == "private" && c.PostForm("notify") == "true" && !s.AccountManager.IsLocked() {
+		note := c.PostForm("note")
+		for _, recipient := range crypto.ParsePubKeyList(recipientPubKey) {
+			go func(file db.File, recipient string) {
+				shareLink, err := s.signedFileLink(file, recipient, note)
+				if err != nil {
+					fmt.Printf("Warning: Failed to build link for %s: %v\n", recipient, err)
+					return
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				if err := s.sendNotice(ctx, recipient, shareLink, note); err != nil {
+					fmt.Printf("Warning: Failed to notify %s: %v\n", recipient, err)
+				}
+			}(newFile, recipient)
+		}
+	}
+
 	c.JSON(http.StatusOK, newFile)
 }
 
 func (s *Server) handleListFiles(c *gin.Context, database *gorm.DB) {
+	query := database.Model(&db.File{})
+	// Scope to a virtual folder when asked; 0 or "root" is the top level
+	if raw, ok := c.GetQuery("folder_id"); ok {
+		folderID, err := parseFolderID(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if folderID == nil {
+			query = query.Where("folder_id IS NULL")
+		} else {
+			query = query.Where("folder_id = ?", *folderID)
+		}
+	}
+
+	query, err := applyListFilters(query, c, "(is_folder = 1 OR mime_type = 'inode/directory')")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	list, err := parseListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	if list.Paged {
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
+			return
+		}
+	}
+	query, err = list.apply(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor for this sort"})
+		return
+	}
+
 	var files []db.File
-	// Order by newest first
-	if err := database.Order("created_at desc").Find(&files).Error; err != nil {
+	if err := query.Find(&files).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
 		return
 	}
-	c.JSON(http.StatusOK, files)
+
+	var next string
+	if list.Paged && len(files) > list.Limit {
+		files = files[:list.Limit]
+		last := files[len(files)-1]
+		next = list.nextCursor(listSortValue(list.Sort, last.Name, last.MimeType, last.Size, last.CreatedAt), last.ID)
+	}
+	s.attachFileTags(files)
+	if !list.Paged {
+		c.JSON(http.StatusOK, files)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": files, "total": total, "next_cursor": next})
 }
 
 func (s *Server) handleDeleteFile(c *gin.Context, database *gorm.DB) {
@@ -629,18 +874,24 @@ func (s *Server) handleDeleteFile(c *gin.Context, database *gorm.DB) {
 		return
 	}
 
-	// Unpin from IPFS
-	if err := s.Node.Unpin(c.Request.Context(), file.CID); err != nil {
-		// Just log error, don't stop DB deletion
-		fmt.Printf("Warning: Failed to unpin CID %s: %v\n", file.CID, err)
-	}
-
-	if err := database.Delete(&file).Error; err != nil {
+	shares, err := s.deleteFile(database, file)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+	c.JSON(http.StatusOK, gin.H{"status": "trashed", "affected_shares": shares})
+}
+
+// deleteFile moves a file to the trash. Its pin stays until the trash is
+// purged, so it can be restored. It returns the outstanding shares of the
+// file, whose links stop resolving once the content is gone.
+func (s *Server) deleteFile(database *gorm.DB, file db.File) ([]db.IssuedShare, error) {
+	shares, err := outstandingShares(database, file.ID)
+	if err != nil {
+		fmt.Printf("Warning: Failed to list shares of file %d: %v\n", file.ID, err)
+	}
+	return shares, database.Delete(&file).Error
 }
 
 func (s *Server) handleSyncFiles(c *gin.Context, database *gorm.DB) {
@@ -652,9 +903,10 @@ func (s *Server) handleSyncFiles(c *gin.Context, database *gorm.DB) {
 
 	addedCount := 0
 	for _, cid := range pins {
-		var count int64
-		database.Model(&db.File{}).Where("cid = ?", cid).Count(&count)
-		if count == 0 {
+		// Skip pins we already hold: files (trashed ones too), bundle
+		// manifests, short links and feeds
+		count, err := db.PinRefCount(database, cid)
+		if err == nil && count == 0 {
 			// New file found
 			newFile := db.File{
 				CID:       cid,
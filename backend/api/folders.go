@@ -0,0 +1,334 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mochibox-core/db"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Ways to delete a folder that still has contents
+const (
+	folderDeleteMoveUp = "move_up" // Contents move to the parent folder
+	folderDeleteAll    = "delete"  // Contents are deleted and their files moved to the trash
+)
+
+func (s *Server) registerFolderRoutes(api *gin.RouterGroup) {
+	folders := api.Group("/folders")
+	{
+		folders.GET("", s.handleListFolders)
+		folders.POST("", s.handleCreateFolder)
+		folders.GET("/:id", s.handleGetFolder)
+		folders.PUT("/:id", s.handleRenameFolder)
+		folders.POST("/:id/move", s.handleMoveFolder)
+		folders.DELETE("/:id", s.handleDeleteFolder)
+	}
+}
+
+// parseFolderID reads a folder reference; "", "0" and "root" mean the top level
+func parseFolderID(raw string) (*uint, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "0" || raw == "root" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return nil, errors.New("Invalid folder ID")
+	}
+	folderID := uint(id)
+	return &folderID, nil
+}
+
+// folderRef maps the JSON convention of 0 = top level to a nullable ID
+func folderRef(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+func (s *Server) folderExists(id *uint) bool {
+	if id == nil {
+		return true
+	}
+	var count int64
+	s.DB.Model(&db.Folder{}).Where("id = ?", *id).Count(&count)
+	return count > 0
+}
+
+// folderPath returns the folder and its ancestors, top level first
+func (s *Server) folderPath(folder db.Folder) []db.Folder {
+	path := []db.Folder{folder}
+	seen := map[uint]bool{folder.ID: true}
+	for folder.ParentID != nil && !seen[*folder.ParentID] {
+		var parent db.Folder
+		if err := s.DB.First(&parent, *folder.ParentID).Error; err != nil {
+			break
+		}
+		seen[parent.ID] = true
+		path = append([]db.Folder{parent}, path...)
+		folder = parent
+	}
+	return path
+}
+
+// folderSubtree returns the IDs of a folder and all folders below it
+func folderSubtree(database *gorm.DB, rootID uint) ([]uint, error) {
+	ids := []uint{rootID}
+	frontier := []uint{rootID}
+	for len(frontier) > 0 {
+		var children []uint
+		if err := database.Model(&db.Folder{}).Where("parent_id IN ?", frontier).Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		ids = append(ids, children...)
+		frontier = children
+	}
+	return ids, nil
+}
+
+// handleListFolders lists the children of parent_id, or every folder when
+// no parent is given so clients can build the whole tree
+func (s *Server) handleListFolders(c *gin.Context) {
+	query := s.DB.Model(&db.Folder{})
+	if raw, ok := c.GetQuery("parent_id"); ok {
+		parentID, err := parseFolderID(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if parentID == nil {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *parentID)
+		}
+	}
+	var folders []db.Folder
+	if err := query.Order("name asc").Find(&folders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch folders"})
+		return
+	}
+	c.JSON(http.StatusOK, folders)
+}
+
+// handleGetFolder returns a folder with its breadcrumb path and direct contents
+func (s *Server) handleGetFolder(c *gin.Context) {
+	var folder db.Folder
+	if err := s.DB.First(&folder, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+	var children []db.Folder
+	s.DB.Where("parent_id = ?", folder.ID).Order("name asc").Find(&children)
+	var fileCount int64
+	s.DB.Model(&db.File{}).Where("folder_id = ?", folder.ID).Count(&fileCount)
+
+	c.JSON(http.StatusOK, gin.H{
+		"folder":     folder,
+		"path":       s.folderPath(folder),
+		"folders":    children,
+		"file_count": fileCount,
+	})
+}
+
+func (s *Server) handleCreateFolder(c *gin.Context) {
+	var req struct {
+		Name     string `json:"name" binding:"required"`
+		ParentID uint   `json:"parent_id"` // 0 = top level
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Folder name required"})
+		return
+	}
+	parentID := folderRef(req.ParentID)
+	if !s.folderExists(parentID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Parent folder not found"})
+		return
+	}
+
+	folder := db.Folder{Name: name, ParentID: parentID}
+	if err := s.DB.Create(&folder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create folder"})
+		return
+	}
+	c.JSON(http.StatusOK, folder)
+}
+
+func (s *Server) handleRenameFolder(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Folder name required"})
+		return
+	}
+
+	var folder db.Folder
+	if err := s.DB.First(&folder, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+	folder.Name = name
+	if err := s.DB.Save(&folder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename folder"})
+		return
+	}
+	c.JSON(http.StatusOK, folder)
+}
+
+// handleMoveFolder re-parents a folder; it cannot move below itself
+func (s *Server) handleMoveFolder(c *gin.Context) {
+	var req struct {
+		ParentID uint `json:"parent_id"` // 0 = top level
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var folder db.Folder
+	if err := s.DB.First(&folder, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+	parentID := folderRef(req.ParentID)
+	if !s.folderExists(parentID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Parent folder not found"})
+		return
+	}
+	if parentID != nil {
+		subtree, err := folderSubtree(s.DB, folder.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move folder"})
+			return
+		}
+		for _, id := range subtree {
+			if id == *parentID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot move a folder into itself"})
+				return
+			}
+		}
+	}
+
+	folder.ParentID = parentID
+	if err := s.DB.Save(&folder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move folder"})
+		return
+	}
+	c.JSON(http.StatusOK, folder)
+}
+
+// handleMoveFiles moves files from My Files into a folder
+func (s *Server) handleMoveFiles(c *gin.Context) {
+	var req struct {
+		FileIDs  []uint `json:"file_ids" binding:"required"`
+		FolderID uint   `json:"folder_id"` // 0 = top level
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	folderID := folderRef(req.FolderID)
+	if !s.folderExists(folderID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+
+	res := s.DB.Model(&db.File{}).Where("id IN ?", req.FileIDs).Update("folder_id", folderID)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move files"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "moved", "moved": res.RowsAffected})
+}
+
+// handleDeleteFolder deletes a folder. A non-empty folder needs mode=move_up
+// to hand its contents to the parent, or mode=delete to delete them too.
+func (s *Server) handleDeleteFolder(c *gin.Context) {
+	var folder db.Folder
+	if err := s.DB.First(&folder, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+
+	var folderCount, fileCount int64
+	s.DB.Model(&db.Folder{}).Where("parent_id = ?", folder.ID).Count(&folderCount)
+	s.DB.Model(&db.File{}).Where("folder_id = ?", folder.ID).Count(&fileCount)
+
+	mode := c.Query("mode")
+	if folderCount+fileCount == 0 {
+		mode = folderDeleteMoveUp
+	}
+
+	switch mode {
+	case folderDeleteMoveUp:
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&db.Folder{}).Where("parent_id = ?", folder.ID).Update("parent_id", folder.ParentID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&db.File{}).Where("folder_id = ?", folder.ID).Update("folder_id", folder.ParentID).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&folder).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "deleted", "moved_folders": folderCount, "moved_files": fileCount})
+
+	case folderDeleteAll:
+		subtree, err := folderSubtree(s.DB, folder.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+			return
+		}
+		var files []db.File
+		if err := s.DB.Where("folder_id IN ?", subtree).Find(&files).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+			return
+		}
+
+		affected := make([]db.IssuedShare, 0)
+		for _, file := range files {
+			shares, err := s.deleteFile(s.DB, file)
+			affected = append(affected, shares...)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete " + file.Name, "affected_shares": affected})
+				return
+			}
+		}
+		if err := s.DB.Where("id IN ?", subtree).Delete(&db.Folder{}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":          "deleted",
+			"deleted_folders": len(subtree),
+			"deleted_files":   len(files),
+			"affected_shares": affected,
+		})
+
+	default:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Folder is not empty; choose mode=move_up or mode=delete",
+			"folders": folderCount,
+			"files":   fileCount,
+		})
+	}
+}
@@ -1,11 +1,10 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"encoding/hex"
-	"encoding/base64"
 	"mime"
 	"path/filepath"
 	"strings"
@@ -15,6 +14,7 @@ import (
 	"mochibox-core/db"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ipfs/boxo/files"
 )
 
 func (s *Server) registerGatewayRoutes(g *gin.RouterGroup) {
@@ -75,23 +75,8 @@ func (s *Server) handlePreview(c *gin.Context) {
             
             // Try saved password if needed
             if password == "" && savedPassword != "" {
-                 if s.AccountManager.Wallet != nil {
-                     // Decrypt saved password
-                     encPass, err := base64.StdEncoding.DecodeString(savedPassword)
-                     if err == nil {
-                         // Convert Ed25519 keys to Curve25519 for Box
-                         curvePub, _ := crypto.Ed25519PublicKeyToCurve25519(s.AccountManager.Wallet.PublicKey)
-                         curvePriv, _ := crypto.Ed25519PrivateKeyToCurve25519(s.AccountManager.Wallet.PrivateKey)
-                         var pubKey [32]byte
-                         var privKey [32]byte
-                         copy(pubKey[:], curvePub)
-                         copy(privKey[:], curvePriv)
-                         
-                         decrypted, err := crypto.DecryptBoxAnonymous(encPass, &pubKey, &privKey)
-                         if err == nil {
-                             password = string(decrypted)
-                         }
-                     }
+                 if decrypted, err := s.openSavedPassword(savedPassword); err == nil {
+                     password = decrypted
                  }
             }
             
@@ -100,37 +85,16 @@ func (s *Server) handlePreview(c *gin.Context) {
                 return
             }
             
-            salt, err := hex.DecodeString(encryptionMeta)
+            key, err := crypto.DeriveKeyFromSalt(password, encryptionMeta)
             if err != nil {
                 c.String(http.StatusInternalServerError, "Invalid salt in DB")
                 return
             }
             
-            key := crypto.DeriveKey(password, salt)
-            
-            // Try Seekable Decryption if source supports Seek
-            if rs, ok := reader.(io.ReadSeeker); ok {
-                decReader, err := crypto.NewSeekableAESCTRDecrypter(rs, key, size)
-                if err != nil {
-                    c.String(http.StatusInternalServerError, "Decryption init failed")
-                    return
-                }
-                reader = decReader
-                // Adjust size for IV
-                if size > 16 {
-                    size -= 16
-                }
-            } else {
-                decReader, err := crypto.NewAESCTRDecrypter(reader, key)
-                if err != nil {
-                    c.String(http.StatusInternalServerError, "Decryption init failed")
-                    return
-                }
-                reader = decReader
-                // Adjust size for IV
-                if size > 16 {
-                    size -= 16
-                }
+            reader, size, err = decryptPreviewStream(reader, key)
+            if err != nil {
+                writeDecryptError(c, err)
+                return
             }
             
         } else if encryptionType == "private" {
@@ -140,40 +104,31 @@ func (s *Server) handlePreview(c *gin.Context) {
                 return
             }
             
-            // Decrypt Session Key
-            encKey, err := base64.StdEncoding.DecodeString(encryptionMeta)
+            // Decrypt Session Key (our entry in the recipient list)
+            sessionKey, err := s.AccountManager.OpenSessionKey(encryptionMeta)
             if err != nil {
-                c.String(http.StatusInternalServerError, "Invalid metadata")
+                c.String(http.StatusForbidden, "Access denied: " + err.Error())
                 return
             }
             
-            sessionKey, err := s.AccountManager.DecryptBox(encKey)
+            reader, size, err = decryptPreviewStream(reader, sessionKey)
             if err != nil {
-                c.String(http.StatusForbidden, "Access denied: " + err.Error())
+                writeDecryptError(c, err)
                 return
             }
-            
-            // Try Seekable Decryption
-            if rs, ok := reader.(io.ReadSeeker); ok {
-                decReader, err := crypto.NewSeekableAESCTRDecrypter(rs, sessionKey, size)
-                if err != nil {
-                    c.String(http.StatusInternalServerError, "Decryption init failed")
-                    return
-                }
-                reader = decReader
-                if size > 16 {
-                    size -= 16
-                }
-            } else {
-                decReader, err := crypto.NewAESCTRDecrypter(reader, sessionKey)
-                if err != nil {
-                    c.String(http.StatusInternalServerError, "Decryption init failed")
-                    return
-                }
-                reader = decReader
-                if size > 16 {
-                    size -= 16
-                }
+        }
+    }
+
+    // The sealed envelope (v2 containers) is authoritative for name and type.
+    // Records are backfilled when content is imported or pinned, not here:
+    // players issue many range requests per preview.
+    if mr, ok := reader.(crypto.MetadataReader); ok {
+        if meta := mr.Metadata(); meta != nil {
+            if meta.Name != "" {
+                filename = meta.Name
+            }
+            if meta.MimeType != "" {
+                contentType = meta.MimeType
             }
         }
     }
@@ -260,3 +215,31 @@ func (s *Server) handlePreview(c *gin.Context) {
         io.Copy(c.Writer, reader)
     }
 }
+
+// decryptPreviewStream wraps an encrypted IPFS stream for serving. Seekable sources
+// keep Range support and report the plaintext size; the container format is
+// authenticated up front so a wrong key fails before any bytes are written.
+func decryptPreviewStream(reader io.Reader, key []byte) (io.Reader, int64, error) {
+    if rs, ok := reader.(io.ReadSeeker); ok {
+        var physSize int64
+        if f, ok := reader.(files.File); ok {
+            physSize, _ = f.Size()
+        }
+        return crypto.NewSeekableDecrypter(rs, key, physSize)
+    }
+
+    decReader, err := crypto.NewDecryptReader(reader, key)
+    if err != nil {
+        return nil, 0, err
+    }
+    // Plaintext size is unknown without seeking; omit Content-Length
+    return decReader, 0, nil
+}
+
+func writeDecryptError(c *gin.Context, err error) {
+    if errors.Is(err, crypto.ErrAuthFailed) {
+        c.String(http.StatusForbidden, "Access denied: " + err.Error())
+        return
+    }
+    c.String(http.StatusInternalServerError, "Decryption init failed")
+}
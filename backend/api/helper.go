@@ -7,6 +7,9 @@ import (
 	"os"
 	"path/filepath"
 
+	"mochibox-core/crypto"
+	"mochibox-core/db"
+
 	"github.com/ipfs/boxo/files"
 )
 
@@ -123,3 +126,80 @@ func CopyDir(src string, dst string) error {
 	}
 	return nil
 }
+
+// resolveContentKey returns the key an encrypted blob was sealed with: the
+// Argon2 key for password files, or our unwrapped session key for private files
+func (s *Server) resolveContentKey(encryptionType, encryptionMeta, password string) ([]byte, error) {
+	switch encryptionType {
+	case "password":
+		if password == "" {
+			return nil, fmt.Errorf("password required")
+		}
+		return crypto.DeriveKeyFromSalt(password, encryptionMeta)
+	case "private":
+		if s.AccountManager == nil || s.AccountManager.IsLocked() {
+			return nil, fmt.Errorf("account locked")
+		}
+		return s.AccountManager.OpenSessionKey(encryptionMeta)
+	default:
+		return nil, fmt.Errorf("file is not encrypted")
+	}
+}
+
+// readSealedMetadata fetches only the start of an encrypted blob and opens its
+// metadata envelope. It returns (nil, nil) for blobs without one.
+func (s *Server) readSealedMetadata(ctx context.Context, cid string, key []byte) (*crypto.FileMetadata, error) {
+	reader, err := s.Node.GetFile(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return crypto.ReadMetadata(reader, key)
+}
+
+// checkContentKey confirms key opens the encrypted content of cid by
+// authenticating the start of the container. Legacy AES-CTR blobs carry no
+// tag and cannot be checked.
+func (s *Server) checkContentKey(ctx context.Context, cid string, key []byte) error {
+	reader, err := s.Node.GetFile(ctx, cid)
+	if err != nil {
+		return err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	dec, err := crypto.NewDecryptReader(reader, key)
+	if err != nil {
+		return err
+	}
+	if _, err := dec.Read(make([]byte, 1)); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// applySealedMetadata fills My Files and Shared History rows for cid from a
+// decrypted metadata envelope, replacing placeholder names and link-supplied values
+func (s *Server) applySealedMetadata(cid string, meta *crypto.FileMetadata) {
+	if meta == nil || cid == "" {
+		return
+	}
+	updates := map[string]interface{}{}
+	if meta.Name != "" {
+		updates["name"] = meta.Name
+	}
+	if meta.MimeType != "" {
+		updates["mime_type"] = meta.MimeType
+	}
+	if meta.Size > 0 {
+		updates["size"] = meta.Size
+	}
+	if len(updates) == 0 {
+		return
+	}
+	s.DB.Model(&db.SharedFile{}).Where("cid = ?", cid).Updates(updates)
+	updates["sealed_meta"] = true
+	s.DB.Model(&db.File{}).Where("cid = ?", cid).Updates(updates)
+}
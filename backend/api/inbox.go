@@ -0,0 +1,380 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mochibox-core/crypto"
+	"mochibox-core/db"
+	"mochibox-core/inbox"
+	"mochibox-core/link"
+
+	"github.com/gin-gonic/gin"
+	iface "github.com/ipfs/kubo/core/coreiface"
+)
+
+// How often the watcher checks which inbox topic to listen on
+const inboxCheckInterval = 10 * time.Second
+
+// Anyone can publish to an inbox topic, so pending items are capped per
+// sender, and items from strangers also overall so they cannot crowd out
+// contacts. Notices beyond a cap are dropped until the user accepts or
+// dismisses some.
+const (
+	maxPendingPerStranger = 10  // Senders not in the address book, or untrusted
+	maxPendingPerContact  = 100 // Known and trusted contacts
+	maxPendingStrangers   = 500 // All strangers together
+)
+
+var errInboxFull = errors.New("too many pending inbox items")
+
+func (s *Server) registerInboxRoutes(api *gin.RouterGroup) {
+	box := api.Group("/inbox")
+	{
+		box.GET("", s.handleListInbox)
+		box.POST("/send", s.handleSendNotice)
+		box.POST("/:id/accept", s.handleAcceptInboxItem)
+		box.POST("/:id/dismiss", s.handleDismissInboxItem)
+	}
+}
+
+// runInboxWatcher keeps one subscription on the inbox topic of the active
+// identity while the account is unlocked, following locks and identity
+// switches
+func (s *Server) runInboxWatcher() {
+	ticker := time.NewTicker(inboxCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.syncInboxSubscription()
+		<-ticker.C
+	}
+}
+
+func (s *Server) syncInboxSubscription() {
+	var self string
+	if !s.AccountManager.IsLocked() {
+		if profile, err := s.AccountManager.GetProfile(); err == nil {
+			self = strings.ToLower(profile.PublicKey)
+		}
+	}
+
+	s.InboxMu.Lock()
+	defer s.InboxMu.Unlock()
+	if self == s.inboxKey {
+		return
+	}
+	if s.inboxCancel != nil {
+		s.inboxCancel()
+		s.inboxCancel = nil
+	}
+	s.inboxKey = ""
+	if self == "" || s.Node == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := s.Node.Subscribe(ctx, inbox.Topic(self))
+	if err != nil {
+		cancel()
+		log.Printf("Inbox: failed to subscribe: %v", err)
+		return
+	}
+	s.inboxKey, s.inboxCancel = self, cancel
+	go s.readInbox(ctx, sub, self)
+}
+
+// readInbox stores notices until the subscription ends. On an unexpected end
+// the key is cleared so the watcher subscribes again.
+func (s *Server) readInbox(ctx context.Context, sub iface.PubSubSubscription, self string) {
+	defer sub.Close()
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Inbox: subscription ended: %v", err)
+				s.InboxMu.Lock()
+				if s.inboxKey == self {
+					s.inboxCancel()
+					s.inboxKey, s.inboxCancel = "", nil
+				}
+				s.InboxMu.Unlock()
+			}
+			return
+		}
+		if err := s.storeNotice(msg.Data(), msg.From().String(), self); err != nil {
+			log.Printf("Inbox: dropped message from %s: %v", msg.From(), err)
+		}
+	}
+}
+
+// storeNotice opens a sealed notice and records it as a pending inbox item
+func (s *Server) storeNotice(data []byte, fromPeer, self string) error {
+	notice, noticeID, err := inbox.Open(data, s.AccountManager, self)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	s.DB.Model(&db.InboxItem{}).Where("notice_id = ?", noticeID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	if err := s.checkInboxRoom(strings.ToLower(notice.From)); err != nil {
+		return err
+	}
+
+	item := db.InboxItem{
+		NoticeID:   noticeID,
+		Recipient:  self,
+		SenderKey:  strings.ToLower(notice.From),
+		SenderPeer: fromPeer,
+		Link:       notice.Link,
+		Note:       notice.Note,
+		Status:     db.InboxPending,
+		SentAt:     notice.SentAt,
+		CreatedAt:  time.Now(),
+	}
+	// Full links can be summarized right away; short links resolve on accept
+	if !link.IsShort(notice.Link) {
+		l, err := link.Decode(notice.Link, s.AccountManager)
+		if err != nil {
+			return err
+		}
+		if l.SignedBy != "" && !strings.EqualFold(l.SignedBy, notice.From) {
+			return errors.New("link signer does not match notice sender")
+		}
+		item.CID, item.Name, item.Size = l.CID, l.Name, l.Size
+	}
+	return s.DB.Create(&item).Error
+}
+
+// checkInboxRoom refuses another pending item from sender once the sender,
+// or for strangers all strangers together, reached the cap
+func (s *Server) checkInboxRoom(sender string) error {
+	limit := int64(maxPendingPerContact)
+	var contact db.Contact
+	if s.DB.Where("public_key = ?", sender).First(&contact).Error != nil || contact.TrustLevel == db.TrustUntrusted {
+		limit = maxPendingPerStranger
+
+		var strangers int64
+		s.DB.Model(&db.InboxItem{}).
+			Where("status = ? AND sender_key NOT IN (SELECT public_key FROM contacts WHERE trust_level <> ?)", db.InboxPending, db.TrustUntrusted).
+			Count(&strangers)
+		if strangers >= maxPendingStrangers {
+			return errInboxFull
+		}
+	}
+	var pending int64
+	s.DB.Model(&db.InboxItem{}).Where("status = ? AND sender_key = ?", db.InboxPending, sender).Count(&pending)
+	if pending >= limit {
+		return errInboxFull
+	}
+	return nil
+}
+
+// sendNotice seals a link to recipient and publishes it on their inbox topic
+func (s *Server) sendNotice(ctx context.Context, recipient, shareLink, note string) error {
+	if s.AccountManager.IsLocked() {
+		return errors.New("Account locked")
+	}
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		return err
+	}
+	msg, err := inbox.Seal(inbox.Notice{
+		From: profile.PublicKey,
+		To:   recipient,
+		Link: shareLink,
+		Note: note,
+	}, s.AccountManager)
+	if err != nil {
+		return err
+	}
+	return s.Node.Publish(ctx, inbox.Topic(recipient), msg)
+}
+
+// signedFileLink builds a link for a file signed by the active identity and
+// records it in the share ledger
+func (s *Server) signedFileLink(file db.File, recipient, note string) (string, error) {
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		return "", err
+	}
+	payload := link.ForFile(file)
+	payload.IssuedAt = time.Now().Unix()
+	shareLink, err := link.EncodeSigned(payload, s.AccountManager, profile.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	s.recordIssuedShare(file, payload, recipient, "", "", note, true)
+	return shareLink, nil
+}
+
+// inboxOwner returns the active identity's key; each identity sees only the
+// notices sealed to it
+func (s *Server) inboxOwner(c *gin.Context) (string, bool) {
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No account"})
+		return "", false
+	}
+	return strings.ToLower(profile.PublicKey), true
+}
+
+func (s *Server) handleListInbox(c *gin.Context) {
+	owner, ok := s.inboxOwner(c)
+	if !ok {
+		return
+	}
+	query := s.DB.Model(&db.InboxItem{}).Where("recipient = ?", owner)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var items []db.InboxItem
+	if err := query.Order("created_at desc").Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inbox"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(items))
+	for _, item := range items {
+		result = append(result, gin.H{"item": item, "sender": s.describeSigner(item.SenderKey)})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleSendNotice notifies a recipient of a file from My Files or of any link
+func (s *Server) handleSendNotice(c *gin.Context) {
+	var req struct {
+		FileID    uint   `json:"file_id"`
+		Link      string `json:"link"`
+		PublicKey string `json:"public_key"`
+		ContactID uint   `json:"contact_id"`
+		Note      string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if s.AccountManager.IsLocked() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
+		return
+	}
+
+	recipient := req.PublicKey
+	if req.ContactID != 0 {
+		keys, err := s.contactKeys([]uint{req.ContactID})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		recipient = keys[0]
+	}
+	recipients := crypto.ParsePubKeyList(recipient)
+	if len(recipients) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one public key required"})
+		return
+	}
+
+	shareLink := strings.TrimSpace(req.Link)
+	if req.FileID != 0 {
+		var file db.File
+		if err := s.DB.First(&file, req.FileID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		var err error
+		if shareLink, err = s.signedFileLink(file, recipients[0], req.Note); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build link: " + err.Error()})
+			return
+		}
+	}
+	if shareLink == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either file_id or link must be provided"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	if err := s.sendNotice(ctx, recipients[0], shareLink, req.Note); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send notice: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "sent", "link": shareLink})
+}
+
+// handleAcceptInboxItem resolves the notice's link and adds it to Shared History
+func (s *Server) handleAcceptInboxItem(c *gin.Context) {
+	owner, ok := s.inboxOwner(c)
+	if !ok {
+		return
+	}
+	var item db.InboxItem
+	if err := s.DB.Where("recipient = ?", owner).First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	l, err := s.resolveLink(c.Request.Context(), item.Link)
+	if err != nil {
+		writeLinkError(c, l, err)
+		return
+	}
+	if l.Bundle {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bundle links are imported via /api/bundles/import", "bundle": true, "link": item.Link})
+		return
+	}
+	if l.SignedBy != "" && !strings.EqualFold(l.SignedBy, item.SenderKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link signer does not match sender", "code": "invalid_signature"})
+		return
+	}
+
+	file, err := s.saveSharedFile(db.SharedFile{
+		CID:            l.CID,
+		Name:           l.Name,
+		Size:           l.Size,
+		MimeType:       l.MimeType,
+		EncryptionType: l.EncryptionType(),
+		EncryptionMeta: l.EncryptionMeta(),
+		OriginalLink:   l.Raw,
+		SignedBy:       l.SignedBy,
+		ExpiresAt:      l.Expiry(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save history"})
+		return
+	}
+
+	item.Status = db.InboxAccepted
+	item.SharedFileID = file.ID
+	item.CID = l.CID
+	if item.Name == "" {
+		item.Name = file.Name
+	}
+	if err := s.DB.Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update inbox"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"item": item, "file": file})
+}
+
+func (s *Server) handleDismissInboxItem(c *gin.Context) {
+	owner, ok := s.inboxOwner(c)
+	if !ok {
+		return
+	}
+	res := s.DB.Model(&db.InboxItem{}).Where("id = ? AND recipient = ?", c.Param("id"), owner).Update("status", db.InboxDismissed)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dismiss item"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "dismissed"})
+}
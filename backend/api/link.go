@@ -0,0 +1,287 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mochibox-core/db"
+	"mochibox-core/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleGenerateLink builds a Mochi link for a file in My Files, optionally
+// signed by the active identity
+func (s *Server) handleGenerateLink(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		Sign            bool   `json:"sign"`
+		IncludePassword bool   `json:"include_password"`
+		Password        string `json:"password"` // Defaults to the saved password
+		IncludeNodeInfo bool   `json:"include_node_info"`
+		ExpiresIn       int64  `json:"expires_in"` // Seconds from now, 0 = never
+		NotBefore       int64  `json:"not_before"` // Unix seconds, 0 = immediately
+		Note            string `json:"note"`       // Kept in the share ledger only
+		Short           bool   `json:"short"`      // Store the payload on IPFS and return mochi://<cid>
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var file db.File
+	if err := s.DB.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	payload := link.ForFile(file)
+	if err := applyValidity(&payload, req.ExpiresIn, req.NotBefore); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.IncludePassword && payload.Type == link.TypePassword {
+		password := req.Password
+		if password == "" && file.SavedPassword != "" {
+			if decrypted, err := s.openSavedPassword(file.SavedPassword); err == nil {
+				password = decrypted
+			}
+		}
+		if password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Password required"})
+			return
+		}
+		// Warning: Sending password in plain text inside the link
+		payload.Params.Password = password
+	}
+
+	if req.IncludeNodeInfo && s.Node != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		if key, err := s.Node.IPFS.Key().Self(ctx); err == nil {
+			payload.PeerID = key.ID().String()
+			_, payload.Peers = s.nodeAddresses(ctx, payload.PeerID)
+		}
+		cancel()
+	}
+
+	// Short link objects are always signed
+	req.Sign = req.Sign || req.Short
+
+	var shareLink, shortCID string
+	var err error
+	if req.Sign {
+		profile, perr := s.AccountManager.GetProfile()
+		if perr != nil || s.AccountManager.IsLocked() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
+			return
+		}
+		if req.Short {
+			shareLink, shortCID, err = s.storeShortLink(c.Request.Context(), payload, profile.PublicKey)
+		} else {
+			shareLink, err = link.EncodeSigned(payload, s.AccountManager, profile.PublicKey)
+		}
+	} else {
+		shareLink, err = link.Encode(payload)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build link: " + err.Error()})
+		return
+	}
+	s.recordIssuedShare(file, payload, file.RecipientPubKey, "", shortCID, req.Note, req.Sign)
+
+	c.JSON(http.StatusOK, gin.H{
+		"link":      shareLink,
+		"payload":   payload,
+		"signed":    req.Sign,
+		"short_cid": shortCID,
+	})
+}
+
+// handleImportLink decodes a Mochi link, verifies its signature if it has one
+// and records it in Shared History
+func (s *Server) handleImportLink(c *gin.Context) {
+	var req struct {
+		Link string `json:"link" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	l, err := s.resolveLink(c.Request.Context(), req.Link)
+	if err != nil {
+		writeLinkError(c, l, err)
+		return
+	}
+	if l.Bundle {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bundle links are imported via /api/bundles/import", "bundle": true})
+		return
+	}
+
+	file, err := s.saveSharedFile(db.SharedFile{
+		CID:            l.CID,
+		Name:           l.Name,
+		Size:           l.Size,
+		MimeType:       l.MimeType,
+		EncryptionType: l.EncryptionType(),
+		EncryptionMeta: l.EncryptionMeta(),
+		OriginalLink:   l.Raw,
+		SignedBy:       l.SignedBy,
+		ExpiresAt:      l.Expiry(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save history"})
+		return
+	}
+
+	var embeddedPassword string
+	if l.Params != nil {
+		embeddedPassword = l.Params.Password
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file":              file,
+		"signed_by":         l.SignedBy,
+		"verified":          l.SignedBy != "",
+		"signer":            s.describeSigner(l.SignedBy),
+		"unverifiable":      l.Unverifiable(),
+		"expires_at":        l.Expiry(),
+		"embedded_password": embeddedPassword,
+		"pid":               l.PeerID,
+		"peers":             l.Peers,
+	})
+}
+
+// applyValidity stamps the issue time and optional validity window on a new link
+func applyValidity(p *link.Payload, expiresIn, notBefore int64) error {
+	if expiresIn < 0 || notBefore < 0 {
+		return errors.New("Invalid validity window")
+	}
+	now := time.Now()
+	p.IssuedAt = now.Unix()
+	p.NotBefore = notBefore
+	if expiresIn > 0 {
+		p.ExpiresAt = now.Add(time.Duration(expiresIn) * time.Second).Unix()
+	}
+	if p.ExpiresAt != 0 && p.NotBefore != 0 && p.ExpiresAt <= p.NotBefore {
+		return errors.New("Link would expire before it becomes valid")
+	}
+	return nil
+}
+
+// decodeLinkParam decodes and time-checks a link handed to an endpoint that
+// also accepts raw CIDs. It writes the error response and returns false when
+// the link must be refused; a nil link with true means raw was empty.
+func (s *Server) decodeLinkParam(c *gin.Context, raw string) (*link.Link, bool) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, true
+	}
+	l, err := s.resolveLink(c.Request.Context(), raw)
+	if err != nil {
+		writeLinkError(c, l, err)
+		return nil, false
+	}
+	return l, true
+}
+
+// errShortLinkUnresolved means the object behind a short link could not be fetched
+var errShortLinkUnresolved = errors.New("short link object not found")
+
+// resolveLink decodes a full link, or fetches and verifies the object behind a
+// short link, then checks the validity window. On a time error the decoded
+// link is returned alongside it.
+func (s *Server) resolveLink(ctx context.Context, raw string) (*link.Link, error) {
+	objectCID, peers, err := link.ParseShort(raw)
+	if err != nil {
+		return link.DecodeValid(raw, s.AccountManager, time.Now())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// The hints are what make a fresh object findable; dial them first
+	for _, addr := range peers {
+		dialCtx, dialCancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := s.Node.Connect(dialCtx, addr); err != nil {
+			log.Printf("Short link: failed to dial hint %s: %v", addr, err)
+		}
+		dialCancel()
+	}
+
+	reader, err := s.Node.GetFile(ctx, objectCID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errShortLinkUnresolved, err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, link.MaxObjectSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errShortLinkUnresolved, err)
+	}
+	if len(data) > link.MaxObjectSize {
+		return nil, fmt.Errorf("%w: short link object too large", link.ErrInvalidLink)
+	}
+
+	l, err := link.OpenObject(data, s.AccountManager, raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(l.Peers) == 0 {
+		l.Peers = peers
+	}
+	if err := l.CheckTime(time.Now()); err != nil {
+		return l, err
+	}
+	return l, nil
+}
+
+// storeShortLink signs the payload as a small object, adds and pins it, and
+// returns the short link with the payload's peer hints kept inline
+func (s *Server) storeShortLink(ctx context.Context, p link.Payload, pubKeyHex string) (string, string, error) {
+	obj, err := link.SignObject(p, s.AccountManager, pubKeyHex)
+	if err != nil {
+		return "", "", err
+	}
+	objectCID, err := s.Node.AddFile(ctx, bytes.NewReader(obj))
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.Node.Pin(ctx, objectCID); err != nil {
+		return "", "", err
+	}
+	s.holdPin(objectCID, db.PinShortLink, objectCID)
+	go func(cid string) {
+		provideCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		if err := s.Node.Provide(provideCtx, cid); err != nil {
+			log.Printf("Short link: failed to provide %s: %v", cid, err)
+		}
+	}(objectCID)
+	return link.EncodeShort(objectCID, p.Peers), objectCID, nil
+}
+
+// writeLinkError answers a rejected link with a stable error code the
+// frontend can switch on
+func writeLinkError(c *gin.Context, l *link.Link, err error) {
+	switch {
+	case errors.Is(err, link.ErrInvalidSignature):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Digital Signature", "code": "invalid_signature"})
+	case errors.Is(err, link.ErrExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Link expired", "code": "link_expired", "expires_at": l.Expiry()})
+	case errors.Is(err, errShortLinkUnresolved):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "short_link_unresolved"})
+	case errors.Is(err, link.ErrNotYetValid):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Link not yet valid", "code": "link_not_yet_valid", "not_before": time.Unix(l.NotBefore, 0).UTC()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_link"})
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Listings of My Files and Shared History share their query parameters:
+//
+//	sort=name|size|created_at|mime_type  order=asc|desc
+//	encryption_type=  is_folder=true|false  mime=<prefix>  name=<substring>
+//	limit=  cursor=
+//
+// Without limit or cursor the full list is returned as a plain array, as
+// before. With either, the response is a page: {items, total, next_cursor}.
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+)
+
+// Sortable columns; text columns compare case-insensitively
+var listSortColumns = map[string]string{
+	"name":       "name COLLATE NOCASE",
+	"size":       "size",
+	"created_at": "created_at",
+	"mime_type":  "mime_type COLLATE NOCASE",
+}
+
+// listCursor marks the last row of a page. It is only valid for the sort it
+// was issued with.
+type listCursor struct {
+	Sort  string          `json:"s"`
+	Order string          `json:"o"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+type listQuery struct {
+	Sort   string
+	Order  string
+	Limit  int
+	Paged  bool
+	Cursor *listCursor
+}
+
+func parseListQuery(c *gin.Context) (listQuery, error) {
+	q := listQuery{Sort: c.DefaultQuery("sort", "created_at"), Order: strings.ToLower(c.Query("order"))}
+	if _, ok := listSortColumns[q.Sort]; !ok {
+		return q, errors.New("sort must be one of name, size, created_at, mime_type")
+	}
+	switch q.Order {
+	case "":
+		// Newest and largest first, names A to Z
+		q.Order = "desc"
+		if q.Sort == "name" || q.Sort == "mime_type" {
+			q.Order = "asc"
+		}
+	case "asc", "desc":
+	default:
+		return q, errors.New("order must be asc or desc")
+	}
+
+	rawLimit, hasLimit := c.GetQuery("limit")
+	rawCursor, hasCursor := c.GetQuery("cursor")
+	q.Paged = hasLimit || hasCursor
+	if !q.Paged {
+		return q, nil
+	}
+
+	q.Limit = defaultPageSize
+	if hasLimit {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit <= 0 {
+			return q, errors.New("Invalid limit")
+		}
+		q.Limit = min(limit, maxPageSize)
+	}
+	if hasCursor && rawCursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(rawCursor)
+		var cur listCursor
+		if err == nil {
+			err = json.Unmarshal(data, &cur)
+		}
+		if err != nil || cur.Sort != q.Sort || cur.Order != q.Order {
+			return q, errors.New("Invalid cursor for this sort")
+		}
+		q.Cursor = &cur
+	}
+	return q, nil
+}
+
+// applyListFilters adds the filter parameters. isFolder is the SQL condition
+// for a directory in this table.
+func applyListFilters(query *gorm.DB, c *gin.Context, isFolder string) (*gorm.DB, error) {
+	if v := c.Query("encryption_type"); v != "" {
+		query = query.Where("encryption_type = ?", v)
+	}
+	if v := c.Query("is_folder"); v != "" {
+		folder, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("is_folder must be true or false")
+		}
+		if folder {
+			query = query.Where(isFolder)
+		} else {
+			query = query.Where("NOT " + isFolder)
+		}
+	}
+	if v := c.Query("mime"); v != "" {
+		query = query.Where("mime_type LIKE ? ESCAPE '\\'", escapeLike(v)+"%")
+	}
+	if v := c.Query("name"); v != "" {
+		query = query.Where("name LIKE ? ESCAPE '\\'", "%"+escapeLike(v)+"%")
+	}
+	return query, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// apply orders the query, and for pages seeks past the cursor and fetches
+// one extra row to tell whether another page follows
+func (q listQuery) apply(query *gorm.DB) (*gorm.DB, error) {
+	col := listSortColumns[q.Sort]
+	cmp := "<"
+	if q.Order == "asc" {
+		cmp = ">"
+	}
+
+	if q.Cursor != nil {
+		value, err := q.cursorValue()
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("("+col+" "+cmp+" ?) OR ("+col+" = ? AND id "+cmp+" ?)", value, value, q.Cursor.ID)
+	}
+	query = query.Order(col + " " + q.Order).Order("id " + q.Order)
+	if q.Paged {
+		query = query.Limit(q.Limit + 1)
+	}
+	return query, nil
+}
+
+func (q listQuery) cursorValue() (interface{}, error) {
+	var err error
+	switch q.Sort {
+	case "size":
+		var v int64
+		err = json.Unmarshal(q.Cursor.Value, &v)
+		return v, err
+	case "created_at":
+		var v time.Time
+		err = json.Unmarshal(q.Cursor.Value, &v)
+		return v, err
+	default:
+		var v string
+		err = json.Unmarshal(q.Cursor.Value, &v)
+		return v, err
+	}
+}
+
+// listSortValue returns the sort key of a row for building the next cursor
+func listSortValue(sort, name, mimeType string, size int64, createdAt time.Time) interface{} {
+	switch sort {
+	case "name":
+		return name
+	case "mime_type":
+		return mimeType
+	case "size":
+		return size
+	default:
+		return createdAt
+	}
+}
+
+// nextCursor encodes the cursor after the last row of a page
+func (q listQuery) nextCursor(value interface{}, id uint) string {
+	raw, _ := json.Marshal(value)
+	data, _ := json.Marshal(listCursor{Sort: q.Sort, Order: q.Order, Value: raw, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mochibox-core/db"
+	"mochibox-core/link"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleExportPackage writes a signed .mochi package of a file to the
+// download directory, for handing a share over without a network path
+func (s *Server) handleExportPackage(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		ExpiresIn int64  `json:"expires_in"` // Seconds from now, 0 = never
+		NotBefore int64  `json:"not_before"` // Unix seconds, 0 = immediately
+		Note      string `json:"note"`       // Kept in the share ledger only
+	}
+	// Bind JSON if present, ignore error if empty body
+	c.ShouldBindJSON(&req)
+
+	var file db.File
+	if err := s.DB.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil || s.AccountManager.IsLocked() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account locked"})
+		return
+	}
+
+	payload := link.ForFile(file)
+	if err := applyValidity(&payload, req.ExpiresIn, req.NotBefore); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	object, err := link.SignObject(payload, s.AccountManager, profile.PublicKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign package: " + err.Error()})
+		return
+	}
+
+	saveDir, err := s.downloadDir()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create download directory"})
+		return
+	}
+	dstPath := ensureUniquePath(filepath.Join(saveDir, file.Name+link.PackageExt))
+
+	car, err := s.Node.ExportCAR(c.Request.Context(), file.CID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to export DAG: " + err.Error()})
+		return
+	}
+	defer car.Close()
+
+	size, err := writePackage(dstPath, object, car)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write package: " + err.Error()})
+		return
+	}
+	s.recordIssuedShare(file, payload, file.RecipientPubKey, "", "", req.Note, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "saved",
+		"path":       dstPath,
+		"size":       size,
+		"cid":        file.CID,
+		"expires_at": payload.Expiry(),
+	})
+}
+
+// writePackage writes a package file, removing it again if the CAR stream fails
+func writePackage(dstPath string, object []byte, car io.Reader) (int64, error) {
+	f, err := os.Create(dstPath)
+	if err != nil {
+		return 0, err
+	}
+	err = link.WritePackageHeader(f, object)
+	if err == nil {
+		_, err = io.Copy(f, car)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+		return 0, err
+	}
+	info, err := os.Stat(dstPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// handleImportPackage imports a .mochi package, given as an upload or a local
+// path: the CAR blocks go into the node, the root is pinned and the file is
+// recorded in Shared History and My Files as if its link had been opened
+func (s *Server) handleImportPackage(c *gin.Context) {
+	var src io.ReadCloser
+	if header, err := c.FormFile("package"); err == nil {
+		f, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		src = f
+	} else if p := strings.TrimSpace(c.PostForm("path")); p != "" {
+		f, err := os.Open(p)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to open package: " + err.Error()})
+			return
+		}
+		src = f
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "package file or path is required"})
+		return
+	}
+	defer src.Close()
+
+	l, car, err := link.ReadPackageHeader(src, s.AccountManager)
+	if err != nil {
+		if errors.Is(err, link.ErrInvalidPackage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_package"})
+			return
+		}
+		writeLinkError(c, l, err)
+		return
+	}
+	if err := l.CheckTime(time.Now()); err != nil {
+		writeLinkError(c, l, err)
+		return
+	}
+	if l.Bundle {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bundle packages are not supported"})
+		return
+	}
+
+	roots, err := s.Node.ImportCAR(c.Request.Context(), car)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to import blocks: " + err.Error()})
+		return
+	}
+	// Only the linked root stays pinned; a CAR may list others, which are
+	// unpinned unless something else already holds them
+	found := false
+	for _, root := range roots {
+		if root == l.CID {
+			found = true
+			continue
+		}
+		if err := s.releasePin(c.Request.Context(), root, "", ""); err != nil {
+			log.Printf("Package: failed to unpin extra root %s: %v", root, err)
+		}
+	}
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Package does not contain " + l.CID, "code": "invalid_package"})
+		return
+	}
+
+	shared, err := s.saveSharedFile(db.SharedFile{
+		CID:            l.CID,
+		Name:           l.Name,
+		Size:           l.Size,
+		MimeType:       l.MimeType,
+		EncryptionType: l.EncryptionType(),
+		EncryptionMeta: l.EncryptionMeta(),
+		OriginalLink:   l.Raw,
+		SignedBy:       l.SignedBy,
+		ExpiresAt:      l.Expiry(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save history"})
+		return
+	}
+
+	password := c.PostForm("password")
+	if password == "" && l.Params != nil {
+		password = l.Params.Password
+	}
+	s.addPinnedFile(c.Request.Context(), l.CID, l.EncryptionType(), l.EncryptionMeta(), password)
+
+	var file db.File
+	s.DB.Where("cid = ?", l.CID).First(&file)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "imported",
+		"shared":     shared,
+		"file":       file,
+		"signed_by":  l.SignedBy,
+		"signer":     s.describeSigner(l.SignedBy),
+		"expires_at": l.Expiry(),
+	})
+}
+
+// downloadDir returns the configured download directory, creating it if needed
+func (s *Server) downloadDir() (string, error) {
+	var settings db.Settings
+	s.DB.First(&settings)
+
+	saveDir := settings.DownloadPath
+	if saveDir == "" {
+		home, _ := os.UserHomeDir()
+		saveDir = filepath.Join(home, "Downloads")
+	}
+	return saveDir, os.MkdirAll(saveDir, 0755)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"mochibox-core/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// holdPin records that holder needs cid pinned. A failure is logged only;
+// the pin itself is already in place.
+func (s *Server) holdPin(cid, holderType, holderID string) {
+	if err := db.AddPinRef(s.DB, cid, holderType, holderID); err != nil {
+		log.Printf("Pins: failed to record %s reference to %s: %v", holderType, cid, err)
+	}
+}
+
+// releasePin drops a holder's reference to cid and unpins it once nothing
+// else references it. If unpinning fails the reference is kept, so a later
+// release retries. An empty holder releases a pin nothing of ours holds.
+func (s *Server) releasePin(ctx context.Context, cid, holderType, holderID string) error {
+	others, err := db.OtherPinRefs(s.DB, cid, holderType, holderID)
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		if s.Node == nil {
+			return errors.New("IPFS node not ready")
+		}
+		if err := s.Node.Unpin(ctx, cid); err != nil && !isNotPinned(err) {
+			return err
+		}
+	}
+	if holderType == "" {
+		return nil
+	}
+	return db.RemovePinRef(s.DB, cid, holderType, holderID)
+}
+
+func isNotPinned(err error) bool {
+	return strings.Contains(err.Error(), "not pinned")
+}
+
+// handlePinReport compares the node's pins with the references we hold:
+// orphaned pins are referenced by nothing, missing pins are referenced but
+// no longer on the node
+func (s *Server) handlePinReport(c *gin.Context) {
+	if s.Node == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "IPFS node not ready"})
+		return
+	}
+	pins, err := s.Node.ListPins(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list pins: " + err.Error()})
+		return
+	}
+	refs, err := db.PinRefsByCID(s.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pin references"})
+		return
+	}
+
+	pinned := make(map[string]bool, len(pins))
+	orphaned := make([]string, 0)
+	for _, cid := range pins {
+		pinned[cid] = true
+		if len(refs[cid]) == 0 {
+			orphaned = append(orphaned, cid)
+		}
+	}
+	sort.Strings(orphaned)
+
+	missingCIDs := make([]string, 0)
+	for cid := range refs {
+		if !pinned[cid] {
+			missingCIDs = append(missingCIDs, cid)
+		}
+	}
+	sort.Strings(missingCIDs)
+
+	// Name the library files behind each missing pin, trashed ones included
+	var files []db.File
+	if len(missingCIDs) > 0 {
+		s.DB.Unscoped().Where("cid IN ?", missingCIDs).Order("id").Find(&files)
+	}
+	filesByCID := make(map[string][]db.File)
+	for _, file := range files {
+		filesByCID[file.CID] = append(filesByCID[file.CID], file)
+	}
+	missing := make([]gin.H, 0, len(missingCIDs))
+	for _, cid := range missingCIDs {
+		affected := filesByCID[cid]
+		if affected == nil {
+			affected = []db.File{}
+		}
+		missing = append(missing, gin.H{"cid": cid, "refs": refs[cid], "files": affected})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pinned":     len(pins),
+		"referenced": len(refs),
+		"orphaned":   orphaned,
+		"missing":    missing,
+	})
+}
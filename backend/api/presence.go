@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"mochibox-core/db"
+	"mochibox-core/presence"
+
+	"github.com/gin-gonic/gin"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Announce often enough that a record never ages past presence.MaxAge
+const presenceInterval = 30 * time.Second
+
+// nearbyUser is a verified presence record and when it was last heard
+type nearbyUser struct {
+	presence.Record
+	LastSeen time.Time
+}
+
+func (s *Server) registerPresenceRoutes(api *gin.RouterGroup) {
+	nearby := api.Group("/nearby")
+	{
+		nearby.GET("", s.handleListNearby)
+		nearby.POST("/connect", s.handleConnectNearby)
+	}
+}
+
+// runPresence listens for announcements from other MochiBox instances and,
+// when enabled in settings and the account is unlocked, announces our own
+func (s *Server) runPresence() {
+	go s.runPresenceListener()
+
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+	for {
+		_ = s.announcePresence()
+		<-ticker.C
+	}
+}
+
+func (s *Server) runPresenceListener() {
+	for s.Node == nil {
+		time.Sleep(presenceInterval)
+	}
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		sub, err := s.Node.Subscribe(ctx, presence.Topic)
+		if err != nil {
+			cancel()
+			time.Sleep(presenceInterval)
+			continue
+		}
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				log.Printf("Presence: subscription ended: %v", err)
+				break
+			}
+			s.storePresence(msg.Data(), msg.From())
+		}
+		sub.Close()
+		cancel()
+		time.Sleep(presenceInterval)
+	}
+}
+
+// storePresence keeps a record only if its publisher is connected to us over
+// a LAN address; gossip relays records from anywhere on the network
+func (s *Server) storePresence(data []byte, from peer.ID) {
+	record, err := presence.Open(data, from, time.Now())
+	if err != nil {
+		return
+	}
+	if !s.lanPeers()[from] {
+		return
+	}
+	if self, ok := s.selfPeerID(); ok && self == record.PeerID {
+		return
+	}
+
+	s.NearbyMu.Lock()
+	defer s.NearbyMu.Unlock()
+	s.nearby[record.PublicKey] = nearbyUser{Record: *record, LastSeen: time.Now()}
+}
+
+// announcePresence publishes a signed record with our LAN addresses. Nothing
+// is sent unless enabled, nor while no peer is connected over the LAN.
+func (s *Server) announcePresence() error {
+	var settings db.Settings
+	s.DB.First(&settings)
+	if !settings.AnnounceNearby {
+		return errors.New("announcing disabled")
+	}
+	if s.AccountManager.IsLocked() {
+		return errors.New("account locked")
+	}
+	if len(s.lanPeers()) == 0 {
+		return errors.New("no LAN peers")
+	}
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil {
+		return err
+	}
+	peerID, ok := s.selfPeerID()
+	if !ok {
+		return errors.New("node offline")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, shareAddrs := s.nodeAddresses(ctx, peerID)
+	msg, err := presence.Sign(presence.Record{
+		Name:      profile.Name,
+		PublicKey: profile.PublicKey,
+		PeerID:    peerID,
+		Addrs:     presence.LANAddrs(shareAddrs),
+	}, s.AccountManager)
+	if err != nil {
+		return err
+	}
+	return s.Node.Publish(ctx, presence.Topic, msg)
+}
+
+func (s *Server) selfPeerID() (string, bool) {
+	if s.Node == nil {
+		return "", false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	key, err := s.Node.IPFS.Key().Self(ctx)
+	if err != nil {
+		return "", false
+	}
+	return key.ID().String(), true
+}
+
+// lanPeers returns the peers we have a connection to over a LAN address
+func (s *Server) lanPeers() map[peer.ID]bool {
+	result := make(map[peer.ID]bool)
+	if s.Node == nil {
+		return result
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conns, err := s.Node.PeerConnections(ctx)
+	if err != nil {
+		return result
+	}
+	for id, addrs := range conns {
+		for _, addr := range addrs {
+			if presence.IsLANAddr(addr) {
+				result[id] = true
+				break
+			}
+		}
+	}
+	return result
+}
+
+// nearbyUsers returns fresh records, dropping those not heard from in time
+func (s *Server) nearbyUsers() []nearbyUser {
+	s.NearbyMu.Lock()
+	defer s.NearbyMu.Unlock()
+
+	users := make([]nearbyUser, 0, len(s.nearby))
+	for key, u := range s.nearby {
+		if time.Since(u.LastSeen) > presence.MaxAge {
+			delete(s.nearby, key)
+			continue
+		}
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+// handleListNearby lists MochiBox users announcing on the LAN, with their
+// address book status so they can be picked as recipients
+func (s *Server) handleListNearby(c *gin.Context) {
+	users := s.nearbyUsers()
+	result := make([]gin.H, 0, len(users))
+	for _, u := range users {
+		result = append(result, gin.H{
+			"name":       u.Name,
+			"public_key": u.PublicKey,
+			"peer_id":    u.PeerID,
+			"addrs":      u.Addrs,
+			"last_seen":  u.LastSeen,
+			"contact":    s.describeSigner(u.PublicKey),
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleConnectNearby dials a nearby user's node directly
+func (s *Server) handleConnectNearby(c *gin.Context) {
+	var req struct {
+		PublicKey string `json:"public_key" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var target *nearbyUser
+	for _, u := range s.nearbyUsers() {
+		if strings.EqualFold(u.PublicKey, req.PublicKey) {
+			target = &u
+			break
+		}
+	}
+	if target == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not nearby"})
+		return
+	}
+
+	var lastErr error
+	for _, addr := range target.Addrs {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		lastErr = s.Node.Connect(ctx, addr)
+		cancel()
+		if lastErr == nil {
+			c.JSON(http.StatusOK, gin.H{"status": "connected", "addr": addr, "peer_id": target.PeerID})
+			return
+		}
+	}
+	c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to connect: " + lastErr.Error()})
+}
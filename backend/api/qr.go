@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mochibox-core/link"
+	"mochibox-core/qr"
+
+	"github.com/gin-gonic/gin"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	defaultQRSize = 256
+	maxQRSize     = 2048
+)
+
+func (s *Server) registerQRRoutes(api *gin.RouterGroup) {
+	api.GET("/qr", s.handleQRCode)
+	api.POST("/qr", s.handleQRCode)
+}
+
+// handleQRCode renders a Mochi link or a dialable multiaddr (a share_addresses
+// entry of /system/status) as PNG or SVG. GET takes query parameters so the
+// URL can be used as an image source directly; POST takes the same fields as
+// JSON for links too long for a URL. Links that do not fit at the requested
+// level are first stripped of peer hints, then, on POST only, stored as short
+// links if the active identity signed them; only then is the error correction
+// level lowered.
+func (s *Server) handleQRCode(c *gin.Context) {
+	var req struct {
+		Content string `form:"content" json:"content" binding:"required"`
+		Format  string `form:"format" json:"format"` // png (default) or svg
+		Level   string `form:"level" json:"level"`   // L, M (default), Q, H
+		Size    int    `form:"size" json:"size"`     // PNG pixels
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	content := strings.TrimSpace(req.Content)
+
+	if _, err := qr.ParseLevel(req.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := strings.ToLower(req.Format)
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be png or svg"})
+		return
+	}
+	size := req.Size
+	if size <= 0 {
+		size = defaultQRSize
+	}
+	if size > maxQRSize {
+		size = maxQRSize
+	}
+
+	isLink := strings.HasPrefix(content, link.Scheme)
+	if !isLink {
+		if _, err := multiaddr.NewMultiaddr(content); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Content must be a Mochi link or a multiaddr"})
+			return
+		}
+	}
+
+	fallback := ""
+	code, err := qr.Encode(content, req.Level)
+	if errors.Is(err, qr.ErrTooLarge) && isLink {
+		if shorter, ok := s.compactLink(content); ok {
+			code, err = qr.Encode(shorter, req.Level)
+			fallback, content = "no_peers", shorter
+		}
+	}
+	// Storing a short link pins and provides an object, so a plain GET
+	// (e.g. an image source on any page) must not trigger it
+	if errors.Is(err, qr.ErrTooLarge) && isLink && c.Request.Method == http.MethodPost {
+		if short, ok := s.shortenLink(c.Request.Context(), content); ok {
+			code, err = qr.Encode(short, req.Level)
+			fallback, content = "short_link", short
+		}
+	}
+	// Lower error correction is the last resort
+	if errors.Is(err, qr.ErrTooLarge) {
+		code, err = qr.EncodeAtOrBelow(content, req.Level)
+	}
+	if err != nil {
+		if errors.Is(err, qr.ErrTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "code": "too_large_for_qr"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Let the frontend read the metadata from another origin
+	c.Header("Access-Control-Expose-Headers", "X-QR-Level, X-QR-Version, X-QR-Fallback, X-QR-Content")
+	c.Header("X-QR-Level", code.Level)
+	c.Header("X-QR-Version", strconv.Itoa(code.Version))
+	if fallback != "" {
+		// The client should share what the code actually contains
+		c.Header("X-QR-Fallback", fallback)
+		c.Header("X-QR-Content", content)
+	}
+	if format == "svg" {
+		c.Data(http.StatusOK, "image/svg+xml", code.SVG())
+		return
+	}
+	png, err := code.PNG(size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// compactLink drops the optional peer hints from a link. Signed links can only
+// be rebuilt when the active identity signed them.
+func (s *Server) compactLink(raw string) (string, bool) {
+	payload, pubKeyHex, ok := s.rebuildableLink(raw)
+	if !ok || (payload.PeerID == "" && len(payload.Peers) == 0) {
+		return "", false
+	}
+	payload.PeerID, payload.Peers = "", nil
+
+	if pubKeyHex == "" {
+		shorter, err := link.Encode(payload)
+		return shorter, err == nil
+	}
+	shorter, err := link.EncodeSigned(payload, s.AccountManager, pubKeyHex)
+	return shorter, err == nil
+}
+
+// shortenLink stores a link the active identity already signed as a short
+// link object. Unsigned links are never shortened: that would sign a payload
+// the identity did not vouch for.
+func (s *Server) shortenLink(ctx context.Context, raw string) (string, bool) {
+	payload, pubKeyHex, ok := s.rebuildableLink(raw)
+	if !ok || pubKeyHex == "" {
+		return "", false
+	}
+	short, _, err := s.storeShortLink(ctx, payload, pubKeyHex)
+	return short, err == nil
+}
+
+// rebuildableLink decodes a full link we are allowed to re-encode: unsigned
+// links, or links signed by the active identity (whose key is returned)
+func (s *Server) rebuildableLink(raw string) (link.Payload, string, bool) {
+	l, err := link.Decode(raw, s.AccountManager)
+	if err != nil {
+		return link.Payload{}, "", false
+	}
+	if l.SignedBy == "" {
+		return l.Payload, "", true
+	}
+	if s.AccountManager.IsLocked() {
+		return link.Payload{}, "", false
+	}
+	profile, err := s.AccountManager.GetProfile()
+	if err != nil || !strings.EqualFold(profile.PublicKey, l.SignedBy) {
+		return link.Payload{}, "", false
+	}
+	return l.Payload, profile.PublicKey, true
+}
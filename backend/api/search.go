@@ -0,0 +1,163 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mochibox-core/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxSearchResults = 200
+
+func (s *Server) registerSearchRoutes(api *gin.RouterGroup) {
+	api.GET("/search", s.handleSearch)
+}
+
+// parseSearchTime accepts RFC 3339 or a plain date; a plain upper bound
+// covers the whole day
+func parseSearchTime(raw string, endOfDay bool) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+	if err != nil {
+		return nil, errors.New("Invalid date: " + raw)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
+
+func parseSearchFilter(c *gin.Context) (db.SearchFilter, error) {
+	f := db.SearchFilter{
+		Query:          c.Query("q"),
+		Scope:          c.Query("scope"),
+		EncryptionType: c.Query("encryption_type"),
+		Kind:           c.Query("kind"),
+		Tag:            c.Query("tag"),
+		Limit:          50,
+	}
+	switch f.Scope {
+	case "", db.ItemFile, db.ItemShared:
+	default:
+		return f, errors.New("scope must be file or shared")
+	}
+	switch f.Kind {
+	case "", "file", "folder":
+	default:
+		return f, errors.New("kind must be file or folder")
+	}
+
+	var err error
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"min_size", &f.MinSize}, {"max_size", &f.MaxSize}} {
+		if raw := c.Query(p.name); raw != "" {
+			if *p.dst, err = strconv.ParseInt(raw, 10, 64); err != nil || *p.dst < 0 {
+				return f, errors.New("Invalid " + p.name)
+			}
+		}
+	}
+	if raw := c.Query("limit"); raw != "" {
+		if f.Limit, err = strconv.Atoi(raw); err != nil || f.Limit <= 0 {
+			return f, errors.New("Invalid limit")
+		}
+		if f.Limit > maxSearchResults {
+			f.Limit = maxSearchResults
+		}
+	}
+	if f.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		return f, err
+	}
+	if f.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// handleSearch runs a ranked full-text search over My Files and Shared
+// History. Results keep their rank order and carry the full record.
+func (s *Server) handleSearch(c *gin.Context) {
+	filter, err := parseSearchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hits, err := db.Search(s.DB, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed: " + err.Error()})
+		return
+	}
+
+	var fileIDs, sharedIDs []uint
+	for _, hit := range hits {
+		if hit.Source == db.ItemFile {
+			fileIDs = append(fileIDs, hit.ID)
+		} else {
+			sharedIDs = append(sharedIDs, hit.ID)
+		}
+	}
+	files := make(map[uint]db.File)
+	if len(fileIDs) > 0 {
+		var rows []db.File
+		s.DB.Where("id IN ?", fileIDs).Find(&rows)
+		s.attachFileTags(rows)
+		for _, row := range rows {
+			files[row.ID] = row
+		}
+	}
+	shared := make(map[uint]db.SharedFile)
+	if len(sharedIDs) > 0 {
+		var rows []db.SharedFile
+		s.DB.Where("id IN ?", sharedIDs).Find(&rows)
+		s.attachSharedTags(rows)
+		for _, row := range rows {
+			shared[row.ID] = row
+		}
+	}
+
+	results := make([]gin.H, 0, len(hits))
+	for _, hit := range hits {
+		var item interface{}
+		if hit.Source == db.ItemFile {
+			item = files[hit.ID]
+		} else {
+			item = shared[hit.ID]
+		}
+		results = append(results, gin.H{"source": hit.Source, "score": hit.Score, "item": item})
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// attachFileTags fills the Tags of files in place
+func (s *Server) attachFileTags(files []db.File) {
+	ids := make([]uint, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+	}
+	tags, _ := db.TagsFor(s.DB, db.ItemFile, ids)
+	for i := range files {
+		files[i].Tags = tags[files[i].ID]
+	}
+}
+
+// attachSharedTags fills the Tags of shared history entries in place
+func (s *Server) attachSharedTags(history []db.SharedFile) {
+	ids := make([]uint, len(history))
+	for i, h := range history {
+		ids[i] = h.ID
+	}
+	tags, _ := db.TagsFor(s.DB, db.ItemShared, ids)
+	for i := range history {
+		history[i].Tags = tags[history[i].ID]
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"mochibox-core/core"
 	"sync"
 
@@ -28,6 +29,15 @@ type Server struct {
 	ParallelDownloader *core.ParallelDownloader
 	ConnectionManager  *core.ConnectionManager
 	HealthMonitor      *core.HealthMonitor
+
+	// Pubsub inbox subscription of the active identity
+	InboxMu     sync.Mutex
+	inboxKey    string
+	inboxCancel context.CancelFunc
+
+	// Other MochiBox users announcing on the LAN, keyed by public key
+	NearbyMu sync.Mutex
+	nearby   map[string]nearbyUser
 }
 
 func NewServer(node *core.MochiNode, database *gorm.DB, ipfsMgr *core.IpfsManager, accMgr *core.AccountManager) *Server {
@@ -65,11 +75,24 @@ func NewServer(node *core.MochiNode, database *gorm.DB, ipfsMgr *core.IpfsManage
 		ParallelDownloader: parallelDL,
 		ConnectionManager:  connMgr,
 		HealthMonitor:      healthMon,
+		nearby:             make(map[string]nearbyUser),
 	}
 
 	// Start health monitor for periodic maintenance
 	healthMon.Start()
 
+	// Listen for share notices while the account is unlocked
+	go s.runInboxWatcher()
+
+	// Announce ourselves and discover other users on the local network
+	go s.runPresence()
+
+	// Poll followed feeds and keep our own feed published
+	go s.runFeedWatcher()
+
+	// Purge files that outlived the trash retention period
+	go s.runTrashPurge()
+
 	s.RegisterRoutes()
 	return s
 }
@@ -88,6 +111,17 @@ func (s *Server) RegisterRoutes() {
 		s.registerSharedRoutes(api)
 		s.registerAccountRoutes(api)
 		s.registerTaskRoutes(api)
+		s.registerBundleRoutes(api)
+		s.registerShareRoutes(api)
+		s.registerQRRoutes(api)
+		s.registerContactRoutes(api)
+		s.registerInboxRoutes(api)
+		s.registerPresenceRoutes(api)
+		s.registerFeedRoutes(api)
+		s.registerFolderRoutes(api)
+		s.registerTagRoutes(api)
+		s.registerSearchRoutes(api)
+		s.registerTrashRoutes(api)
 	}
 
 	s.registerFileRoutes(s.DB)
@@ -9,17 +9,22 @@ import (
 	"sync"
 	"time"
 
+	"mochibox-core/crypto"
 	"mochibox-core/db"
+	"mochibox-core/link"
 
 	"github.com/gin-gonic/gin"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
+	"gorm.io/gorm"
 )
 
 func (s *Server) registerSharedRoutes(api *gin.RouterGroup) {
 	shared := api.Group("/shared")
 	{
 		shared.POST("/history", s.handleAddSharedHistory)
+		shared.POST("/import", s.handleImportLink)
+		shared.POST("/package", s.handleImportPackage)
 		shared.GET("/history", s.handleListSharedHistory)
 		shared.DELETE("/history/:id", s.handleDeleteSharedHistory)
 		shared.DELETE("/history", s.handleClearSharedHistory)
@@ -251,6 +256,8 @@ func (s *Server) handlePinShared(c *gin.Context) {
 		CID            string `json:"cid" binding:"required"`
 		EncryptionType string `json:"encryption_type"`
 		EncryptionMeta string `json:"encryption_meta"`
+		Password       string `json:"password"` // Optional, to read the sealed envelope of password files
+		Link           string `json:"link"`     // Optional Mochi link; refused if expired
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -258,6 +265,21 @@ func (s *Server) handlePinShared(c *gin.Context) {
 		return
 	}
 
+	if strings.HasPrefix(strings.TrimSpace(req.Link), link.Scheme) {
+		l, ok := s.decodeLinkParam(c, req.Link)
+		if !ok {
+			return
+		}
+		if l.CID != req.CID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Link does not match CID", "code": "invalid_link"})
+			return
+		}
+		if req.EncryptionType == "" {
+			req.EncryptionType = l.EncryptionType()
+			req.EncryptionMeta = l.EncryptionMeta()
+		}
+	}
+
 	// This might block, but we want that for now so frontend knows when it's done
 	// Ideally, for very large files, this should be async or we rely on IPFS background fetching.
 	// But `ipfs pin add` blocks until complete.
@@ -266,16 +288,32 @@ func (s *Server) handlePinShared(c *gin.Context) {
 		return
 	}
 
+	s.addPinnedFile(c.Request.Context(), req.CID, req.EncryptionType, req.EncryptionMeta, req.Password)
+
+	c.JSON(http.StatusOK, gin.H{"status": "pinned", "cid": req.CID})
+}
+
+// addPinnedFile adds pinned content to My Files, or refreshes the encryption
+// metadata of an existing entry
+func (s *Server) addPinnedFile(ctx context.Context, cid, encryptionType, encryptionMeta, password string) {
+	// Encrypted links may carry no name/size; read them from the sealed envelope
+	var sealedMeta *crypto.FileMetadata
+	if encryptionType == "password" || encryptionType == "private" {
+		if key, err := s.resolveContentKey(encryptionType, encryptionMeta, password); err == nil {
+			sealedMeta, _ = s.readSealedMetadata(ctx, cid, key)
+		}
+	}
+
 	// Add to My Files (DB) if not exists
 	var count int64
-	s.DB.Model(&db.File{}).Where("cid = ?", req.CID).Count(&count)
+	s.DB.Model(&db.File{}).Where("cid = ?", cid).Count(&count)
 	if count == 0 {
 		newFile := db.File{
-			CID:            req.CID,
+			CID:            cid,
 			CreatedAt:      time.Now(),
 			MimeType:       "application/octet-stream",
-			EncryptionType: req.EncryptionType,
-			EncryptionMeta: req.EncryptionMeta,
+			EncryptionType: encryptionType,
+			EncryptionMeta: encryptionMeta,
 		}
 
 		if newFile.EncryptionType == "" {
@@ -284,7 +322,7 @@ func (s *Server) handlePinShared(c *gin.Context) {
 
 		// Try to find name from Shared History
 		var sharedFile db.SharedFile
-		if err := s.DB.Where("cid = ?", req.CID).First(&sharedFile).Error; err == nil {
+		if err := s.DB.Where("cid = ?", cid).First(&sharedFile).Error; err == nil {
 			newFile.Name = sharedFile.Name
 			if sharedFile.MimeType != "" {
 				newFile.MimeType = sharedFile.MimeType
@@ -294,14 +332,27 @@ func (s *Server) handlePinShared(c *gin.Context) {
 			}
 		}
 
+		if sealedMeta != nil {
+			newFile.SealedMeta = true
+			if sealedMeta.Name != "" {
+				newFile.Name = sealedMeta.Name
+			}
+			if sealedMeta.MimeType != "" {
+				newFile.MimeType = sealedMeta.MimeType
+			}
+			if sealedMeta.Size > 0 {
+				newFile.Size = sealedMeta.Size
+			}
+		}
+
 		// If still no name, use default
 		if newFile.Name == "" {
-			newFile.Name = "Pinned-" + req.CID[:8]
+			newFile.Name = "Pinned-" + cid[:8]
 		}
 
 		// Get Size
 		if newFile.Size == 0 {
-			size, err := s.Node.GetFileSize(c.Request.Context(), req.CID)
+			size, err := s.Node.GetFileSize(ctx, cid)
 			if err == nil {
 				newFile.Size = size
 			}
@@ -314,24 +365,63 @@ func (s *Server) handlePinShared(c *gin.Context) {
 		// Update encryption metadata if existing record is missing it (e.g. was public, now known private)
 		// Or if we re-pin a shared file we now have keys for.
 		// Let's update it if provided.
-		if req.EncryptionType != "" {
-			s.DB.Model(&db.File{}).Where("cid = ?", req.CID).Updates(map[string]interface{}{
-				"encryption_type": req.EncryptionType,
-				"encryption_meta": req.EncryptionMeta,
+		if encryptionType != "" {
+			s.DB.Model(&db.File{}).Where("cid = ?", cid).Updates(map[string]interface{}{
+				"encryption_type": encryptionType,
+				"encryption_meta": encryptionMeta,
 			})
 		}
 	}
-
-	c.JSON(http.StatusOK, gin.H{"status": "pinned", "cid": req.CID})
+	s.applySealedMetadata(cid, sealedMeta)
 }
 
 func (s *Server) handleListSharedHistory(c *gin.Context) {
+	query, err := applyListFilters(s.DB.Model(&db.SharedFile{}), c, "mime_type = 'inode/directory'")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	list, err := parseListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	if list.Paged {
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
+			return
+		}
+	}
+	query, err = list.apply(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor for this sort"})
+		return
+	}
+
 	var history []db.SharedFile
-	if err := s.DB.Order("created_at desc").Find(&history).Error; err != nil {
+	if err := query.Find(&history).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
 		return
 	}
-	c.JSON(http.StatusOK, history)
+
+	var next string
+	if list.Paged && len(history) > list.Limit {
+		history = history[:list.Limit]
+		last := history[len(history)-1]
+		next = list.nextCursor(listSortValue(list.Sort, last.Name, last.MimeType, last.Size, last.CreatedAt), last.ID)
+	}
+	now := time.Now()
+	for i := range history {
+		history[i].Expired = history[i].ExpiresAt != nil && !now.Before(*history[i].ExpiresAt)
+	}
+	s.attachSharedTags(history)
+	if !list.Paged {
+		c.JSON(http.StatusOK, history)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": history, "total": total, "next_cursor": next})
 }
 
 func (s *Server) handleAddSharedHistory(c *gin.Context) {
@@ -350,6 +440,37 @@ func (s *Server) handleAddSharedHistory(c *gin.Context) {
 		return
 	}
 
+	entry := db.SharedFile{
+		CID:            req.CID,
+		Name:           req.Name,
+		Size:           req.Size,
+		MimeType:       req.MimeType,
+		EncryptionType: req.EncryptionType,
+		EncryptionMeta: req.EncryptionMeta,
+		OriginalLink:   req.OriginalLink,
+	}
+	// Plain CIDs are accepted as-is; Mochi links must verify and be in date
+	if strings.HasPrefix(strings.TrimSpace(req.OriginalLink), link.Scheme) {
+		l, ok := s.decodeLinkParam(c, req.OriginalLink)
+		if !ok {
+			return
+		}
+		entry.SignedBy = l.SignedBy
+		entry.ExpiresAt = l.Expiry()
+	}
+
+	file, err := s.saveSharedFile(entry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+// saveSharedFile records entry in Shared History, merging into an existing row
+// for the same CID. Unknown sizes are fetched in the background.
+func (s *Server) saveSharedFile(req db.SharedFile) (db.SharedFile, error) {
 	// Check if already exists? Maybe just update timestamp?
 	// User might want to keep history of same file opened at different times?
 	// But let's assume we want unique entries by CID to keep list clean.
@@ -376,23 +497,23 @@ func (s *Server) handleAddSharedHistory(c *gin.Context) {
 		if req.OriginalLink != "" {
 			existing.OriginalLink = req.OriginalLink
 		}
+		if req.SignedBy != "" {
+			existing.SignedBy = req.SignedBy
+		}
+		if req.BundleCID != "" {
+			existing.BundleCID = req.BundleCID
+		}
+		if req.OriginalLink != "" {
+			existing.ExpiresAt = req.ExpiresAt
+		}
 
-		s.DB.Save(&existing)
-		c.JSON(http.StatusOK, existing)
-		return
+		err := s.DB.Save(&existing).Error
+		return existing, err
 	}
 
 	// Create new
-	file := db.SharedFile{
-		CID:            req.CID,
-		Name:           req.Name,
-		Size:           req.Size,
-		CreatedAt:      time.Now(),
-		MimeType:       req.MimeType,
-		EncryptionType: req.EncryptionType,
-		EncryptionMeta: req.EncryptionMeta,
-		OriginalLink:   req.OriginalLink,
-	}
+	file := req
+	file.CreatedAt = time.Now()
 
 	if file.MimeType == "" {
 		file.MimeType = "application/octet-stream"
@@ -407,8 +528,7 @@ func (s *Server) handleAddSharedHistory(c *gin.Context) {
 	}
 
 	if err := s.DB.Create(&file).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save history"})
-		return
+		return file, err
 	}
 
 	// Async fetch size if unknown
@@ -427,7 +547,7 @@ func (s *Server) handleAddSharedHistory(c *gin.Context) {
 		}(file.CID)
 	}
 
-	c.JSON(http.StatusOK, file)
+	return file, nil
 }
 
 func (s *Server) handleDeleteSharedHistory(c *gin.Context) {
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mochibox-core/db"
+	"mochibox-core/link"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func (s *Server) registerShareRoutes(api *gin.RouterGroup) {
+	shares := api.Group("/shares")
+	{
+		shares.GET("", s.handleListIssuedShares)
+		shares.PUT("/:id", s.handleUpdateIssuedShare)
+		shares.DELETE("/:id", s.handleDeleteIssuedShare)
+	}
+}
+
+// recordIssuedShare writes a ledger entry for a link we just handed out. For
+// bundles p is the bundle link payload, recorded once per file it contains. A
+// failure is logged only; the link itself is already valid.
+func (s *Server) recordIssuedShare(file db.File, p link.Payload, recipients, bundleCID, shortCID, note string, signed bool) {
+	hash, err := link.Hash(p)
+	if err != nil {
+		log.Printf("Share ledger: failed to hash payload for %s: %v", file.CID, err)
+		return
+	}
+	entry := db.IssuedShare{
+		FileID:       file.ID,
+		CID:          file.CID,
+		PayloadHash:  hash,
+		Mode:         p.EncryptionType(),
+		RecipientKey: recipients,
+		Signed:       signed,
+		BundleCID:    bundleCID,
+		ShortCID:     shortCID,
+		ExpiresAt:    p.Expiry(),
+		Note:         note,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.DB.Create(&entry).Error; err != nil {
+		log.Printf("Share ledger: failed to record share of %s: %v", file.CID, err)
+	}
+}
+
+// outstandingShares returns ledger entries of a file whose links have not expired
+func outstandingShares(database *gorm.DB, fileID uint) ([]db.IssuedShare, error) {
+	var shares []db.IssuedShare
+	err := database.Where("file_id = ? AND (expires_at IS NULL OR expires_at > ?)", fileID, time.Now()).
+		Order("created_at desc").Find(&shares).Error
+	return shares, err
+}
+
+// handleListIssuedShares lists the ledger, newest first. Filters: file_id,
+// mode, recipient (matches one key of the list), active=true for unexpired only.
+func (s *Server) handleListIssuedShares(c *gin.Context) {
+	query := s.DB.Model(&db.IssuedShare{})
+	if fileID := c.Query("file_id"); fileID != "" {
+		query = query.Where("file_id = ?", fileID)
+	}
+	if mode := c.Query("mode"); mode != "" {
+		query = query.Where("mode = ?", mode)
+	}
+	if recipient := strings.ToLower(strings.TrimSpace(c.Query("recipient"))); recipient != "" {
+		query = query.Where("recipient_key LIKE ?", "%"+recipient+"%")
+	}
+	if c.Query("active") == "true" {
+		query = query.Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	}
+
+	var shares []db.IssuedShare
+	if err := query.Order("created_at desc").Find(&shares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shares"})
+		return
+	}
+	c.JSON(http.StatusOK, shares)
+}
+
+func (s *Server) handleUpdateIssuedShare(c *gin.Context) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var share db.IssuedShare
+	if err := s.DB.First(&share, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return
+	}
+	share.Note = req.Note
+	if err := s.DB.Save(&share).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update share"})
+		return
+	}
+	c.JSON(http.StatusOK, share)
+}
+
+// handleDeleteIssuedShare forgets a ledger entry. A full link keeps working
+// for whoever has it. Bundle manifests and short link objects are unpinned
+// with the last entry that names them, so those links stop resolving once
+// the object is gone from the network.
+func (s *Server) handleDeleteIssuedShare(c *gin.Context) {
+	var share db.IssuedShare
+	if err := s.DB.First(&share, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return
+	}
+
+	// Release before deleting, so a failed unpin can be retried
+	released := make([]string, 0)
+	for _, ref := range []struct {
+		cid, holderType string
+		match           db.IssuedShare
+	}{
+		{share.BundleCID, db.PinBundle, db.IssuedShare{BundleCID: share.BundleCID}},
+		{share.ShortCID, db.PinShortLink, db.IssuedShare{ShortCID: share.ShortCID}},
+	} {
+		if ref.cid == "" {
+			continue
+		}
+		var others int64
+		s.DB.Model(&db.IssuedShare{}).Where(&ref.match).Where("id <> ?", share.ID).Count(&others)
+		if others > 0 {
+			continue
+		}
+		if err := s.releasePin(c.Request.Context(), ref.cid, ref.holderType, ref.cid); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to unpin " + ref.cid + ": " + err.Error()})
+			return
+		}
+		released = append(released, ref.cid)
+	}
+
+	if err := s.DB.Delete(&share).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete share"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted", "unpinned": released})
+}
@@ -25,6 +25,7 @@ func (s *Server) registerSystemRoutes(rg *gin.RouterGroup) {
 		system.POST("/bootstrap", s.handleBootstrap)
 		system.POST("/shutdown", s.handleShutdown)
 		system.POST("/datadir", s.handleSetDataDir)
+		system.GET("/pins", s.handlePinReport)
 	}
 }
 
@@ -204,10 +205,25 @@ func (s *Server) handleNodeStatus(c *gin.Context) {
 		peerCount = len(peers)
 	}
 
+	peerID := key.ID().String()
+	addrs, shareAddrs := s.nodeAddresses(ctx, peerID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"online":          true,
+		"peer_id":         peerID,
+		"peers":           peerCount,
+		"addresses":       addrs,
+		"share_addresses": shareAddrs,
+		"data_dir":        currentDataDir,
+	})
+}
+
+// nodeAddresses returns the node's listen addresses and the dialable
+// addresses (with /p2p/peerID) worth putting in share links
+func (s *Server) nodeAddresses(ctx context.Context, peerID string) ([]string, []string) {
 	addrs := make([]string, 0)
 	shareAddrs := make([]string, 0)
 	shareSeen := make(map[string]bool)
-	peerID := key.ID().String()
 	tcpPort := "4001"
 
 	listenAddrs, err := s.Node.IPFS.Swarm().ListenAddrs(ctx)
@@ -283,14 +299,7 @@ func (s *Server) handleNodeStatus(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"online":          true,
-		"peer_id":         peerID,
-		"peers":           peerCount,
-		"addresses":       addrs,
-		"share_addresses": shareAddrs,
-		"data_dir":        currentDataDir,
-	})
+	return addrs, shareAddrs
 }
 
 func (s *Server) handleBootstrap(c *gin.Context) {
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mochibox-core/db"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func (s *Server) registerTagRoutes(api *gin.RouterGroup) {
+	tags := api.Group("/tags")
+	{
+		tags.GET("", s.handleListTags)
+		tags.PUT("/:id", s.handleRenameTag)
+		tags.DELETE("/:id", s.handleDeleteTag)
+	}
+
+	// Tags and notes of files in My Files and of Shared History entries
+	api.PUT("/files/:id/tags", s.itemTagsHandler(db.ItemFile, &db.File{}))
+	api.PUT("/files/:id/note", s.itemNoteHandler(&db.File{}))
+	api.PUT("/shared/history/:id/tags", s.itemTagsHandler(db.ItemShared, &db.SharedFile{}))
+	api.PUT("/shared/history/:id/note", s.itemNoteHandler(&db.SharedFile{}))
+}
+
+// handleListTags lists tags with how many items carry each
+func (s *Server) handleListTags(c *gin.Context) {
+	var tags []struct {
+		db.Tag
+		Count int64 `json:"count"`
+	}
+	err := s.DB.Model(&db.Tag{}).
+		Select("tags.*, (SELECT COUNT(*) FROM item_tags WHERE item_tags.tag_id = tags.id) AS count").
+		Order("tags.name").Scan(&tags).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+// handleRenameTag renames a tag everywhere it is used
+func (s *Server) handleRenameTag(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	names, err := db.NormalizeTags([]string{req.Name})
+	if err != nil || len(names) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag name"})
+		return
+	}
+
+	var tag db.Tag
+	if err := s.DB.First(&tag, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	var count int64
+	s.DB.Model(&db.Tag{}).Where("name = ? AND id <> ?", names[0], tag.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tag already exists"})
+		return
+	}
+	tag.Name = names[0]
+	if err := s.DB.Save(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename tag"})
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// handleDeleteTag removes a tag from every item
+func (s *Server) handleDeleteTag(c *gin.Context) {
+	var tag db.Tag
+	if err := s.DB.First(&tag, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&db.ItemTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// itemTagsHandler replaces the tags of a file or shared history entry
+func (s *Server) itemTagsHandler(itemType string, model interface{}) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Tags []string `json:"tags"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		var count int64
+		if err == nil {
+			s.DB.Model(model).Where("id = ?", id).Count(&count)
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+			return
+		}
+
+		tags, err := db.SetTags(s.DB, itemType, uint(id), req.Tags)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tags": tags})
+	}
+}
+
+// itemNoteHandler sets the searchable note of a file or shared history entry
+func (s *Server) itemNoteHandler(model interface{}) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Note string `json:"note"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res := s.DB.Model(model).Where("id = ?", c.Param("id")).Update("note", strings.TrimSpace(req.Note))
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"note": strings.TrimSpace(req.Note)})
+	}
+}
@@ -3,7 +3,6 @@ package api
 import (
 	"context"
 	"crypto/rand"
-	"encoding/base64"
 	"encoding/hex"
 	"io"
 	"log"
@@ -45,7 +44,7 @@ type DownloadTask struct {
 
 	Password       string
 	EncryptionType string // "password" or "private"
-	EncryptionMeta string // Salt (hex) for password, EncryptedKey (base64) for private
+	EncryptionMeta string // KDF salt for password, recipient key list for private
 
 	cancel context.CancelFunc
 }
@@ -129,12 +128,35 @@ func (s *Server) handleDownloadTaskStart(c *gin.Context) {
 		Password       string `json:"password"`
 		EncryptionType string `json:"encryption_type"`
 		EncryptionMeta string `json:"encryption_meta"`
+		Link           string `json:"link"` // Mochi link, alternative to cid; refused if expired
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if req.FileID == 0 && req.Link != "" {
+		l, ok := s.decodeLinkParam(c, req.Link)
+		if !ok {
+			return
+		}
+		if l.Bundle {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bundle links are imported via /api/bundles/import", "bundle": true})
+			return
+		}
+		req.CID = l.CID
+		if req.Name == "" {
+			req.Name = l.Name
+		}
+		if req.EncryptionType == "" {
+			req.EncryptionType = l.EncryptionType()
+			req.EncryptionMeta = l.EncryptionMeta()
+		}
+		if req.Password == "" && l.Params != nil {
+			req.Password = l.Params.Password
+		}
+	}
+
 	var file db.File
 	if req.FileID > 0 {
 		if err := s.DB.First(&file, req.FileID).Error; err != nil {
@@ -151,7 +173,7 @@ func (s *Server) handleDownloadTaskStart(c *gin.Context) {
 		file.EncryptionMeta = req.EncryptionMeta
 		file.Size = 0
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Either file_id or cid must be provided"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either file_id, cid or link must be provided"})
 		return
 	}
 
@@ -426,7 +448,7 @@ func (s *Server) runDownloadTask(ctx context.Context, task *DownloadTask) {
 
 	if task.EncryptionType == "password" && task.Password != "" {
 		// Password-based encryption: derive key from password + salt
-		salt, err := hex.DecodeString(task.EncryptionMeta)
+		key, err := crypto.DeriveKeyFromSalt(task.Password, task.EncryptionMeta)
 		if err != nil {
 			log.Printf("Task %s: Invalid salt in encryption_meta: %v", task.ID, err)
 			task.mu.Lock()
@@ -436,7 +458,7 @@ func (s *Server) runDownloadTask(ctx context.Context, task *DownloadTask) {
 			task.mu.Unlock()
 			return
 		}
-		decryptKey = crypto.DeriveKey(task.Password, salt)
+		decryptKey = key
 		useEncryptedDownload = true
 		log.Printf("Task %s: Using password-based decryption", task.ID)
 	} else if task.EncryptionType == "private" {
@@ -450,17 +472,8 @@ func (s *Server) runDownloadTask(ctx context.Context, task *DownloadTask) {
 			task.mu.Unlock()
 			return
 		}
-		encKeyBytes, err := base64.StdEncoding.DecodeString(task.EncryptionMeta)
-		if err != nil {
-			log.Printf("Task %s: Invalid encrypted key: %v", task.ID, err)
-			task.mu.Lock()
-			task.Status = "error"
-			task.Error = "Invalid encryption metadata"
-			task.UpdatedAt = time.Now()
-			task.mu.Unlock()
-			return
-		}
-		decryptKey, err = s.AccountManager.Wallet.DecryptSessionKey(encKeyBytes)
+		var err error
+		decryptKey, err = s.AccountManager.OpenSessionKey(task.EncryptionMeta)
 		if err != nil {
 			log.Printf("Task %s: Failed to decrypt session key: %v", task.ID, err)
 			task.mu.Lock()
@@ -568,12 +581,15 @@ func (s *Server) runDownloadTask(ctx context.Context, task *DownloadTask) {
 	// Step 6: Execute download with appropriate strategy
 	setPhase("downloading")
 	var downloadErr error
+	var sealedMeta *crypto.FileMetadata
 
 	if useEncryptedDownload {
 		// Encrypted download with pre-derived key
 		log.Printf("Task %s: Starting encrypted download", task.ID)
 		encryptedDL := core.NewEncryptedDownloader(s.ParallelDownloader)
-		downloadErr = encryptedDL.DownloadAndDecrypt(ctx, task.CID, decryptKey, dstWriter, progressCallback)
+		downloadErr = encryptedDL.DownloadAndDecrypt(ctx, task.CID, decryptKey, dstWriter, progressCallback, func(meta *crypto.FileMetadata) {
+			sealedMeta = meta
+		})
 	} else {
 		// Standard download (works for files >= 1MB)
 		log.Printf("Task %s: Starting download", task.ID)
@@ -606,11 +622,40 @@ func (s *Server) runDownloadTask(ctx context.Context, task *DownloadTask) {
 		return
 	}
 
+	// Flush and close before anything else; a failed final write leaves the
+	// file truncated, so the task must not be reported as completed
+	if err := dstWriter.Close(); err != nil {
+		log.Printf("Task %s: Failed to finish writing file: %v", task.ID, err)
+
+		task.mu.Lock()
+		task.Status = "error"
+		task.Error = "Failed to write file: " + err.Error()
+		task.UpdatedAt = time.Now()
+		task.mu.Unlock()
+		return
+	}
+
 	// Success - notify health monitor
 	if s.HealthMonitor != nil {
 		s.HealthMonitor.OnDownloadSuccess(task.CID)
 	}
 
+	// Encrypted links may omit the name; the sealed envelope has the real one
+	if sealedMeta != nil {
+		s.applySealedMetadata(task.CID, sealedMeta)
+		if sealedMeta.Name != "" && sealedMeta.Name != task.Name {
+			newPath := ensureUniquePath(filepath.Join(filepath.Dir(task.DestPath), filepath.Base(sealedMeta.Name)))
+			if err := os.Rename(task.DestPath, newPath); err == nil {
+				task.mu.Lock()
+				task.DestPath = newPath
+				task.Name = sealedMeta.Name
+				task.mu.Unlock()
+			} else {
+				log.Printf("Task %s: Failed to rename to sealed name: %v", task.ID, err)
+			}
+		}
+	}
+
 	// Success
 	task.mu.Lock()
 	task.Status = "completed"
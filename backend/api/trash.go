@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mochibox-core/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+const trashPurgeInterval = time.Hour
+
+func (s *Server) registerTrashRoutes(api *gin.RouterGroup) {
+	trash := api.Group("/trash")
+	{
+		trash.GET("", s.handleListTrash)
+		trash.POST("/:id/restore", s.handleRestoreTrash)
+		trash.DELETE("/:id", s.handlePurgeTrashItem)
+		trash.DELETE("", s.handleEmptyTrash)
+	}
+}
+
+func (s *Server) trashRetention() time.Duration {
+	var settings db.Settings
+	s.DB.First(&settings)
+	return settings.TrashRetention()
+}
+
+// runTrashPurge periodically purges files that have been in the trash
+// longer than the retention period
+func (s *Server) runTrashPurge() {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		if s.Node == nil {
+			continue
+		}
+		var expired []db.File
+		cutoff := time.Now().Add(-s.trashRetention())
+		if err := s.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&expired).Error; err != nil {
+			continue
+		}
+		for _, file := range expired {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := s.purgeFile(ctx, file); err != nil {
+				log.Printf("Trash: failed to purge %s: %v", file.CID, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// purgeFile removes a trashed file for good. The CID is unpinned unless
+// something else still references it; if unpinning fails the row is kept so
+// the next purge retries.
+func (s *Server) purgeFile(ctx context.Context, file db.File) error {
+	if file.CID != "" {
+		if err := s.releasePin(ctx, file.CID, db.PinFile, strconv.FormatUint(uint64(file.ID), 10)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.DB.Unscoped().Delete(&file).Error; err != nil {
+		return err
+	}
+	s.DB.Where("file_id = ?", file.ID).Delete(&db.FeedEntry{})
+	return nil
+}
+
+// handleListTrash lists trashed files, most recently deleted first, with
+// the time each will be purged
+func (s *Server) handleListTrash(c *gin.Context) {
+	var files []db.File
+	if err := s.DB.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trash"})
+		return
+	}
+	retention := s.trashRetention()
+	s.attachFileTags(files)
+
+	result := make([]gin.H, 0, len(files))
+	for _, file := range files {
+		result = append(result, gin.H{"file": file, "purge_at": file.DeletedAt.Time.Add(retention)})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleRestoreTrash moves a file back to My Files. Its folder is kept if it
+// still exists. The CID is pinned again in case the pin went missing while
+// the file was in the trash.
+func (s *Server) handleRestoreTrash(c *gin.Context) {
+	var file db.File
+	if err := s.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&file, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not in trash"})
+		return
+	}
+
+	updates := map[string]interface{}{"deleted_at": nil}
+	if !s.folderExists(file.FolderID) {
+		updates["folder_id"] = nil
+	}
+	if err := s.DB.Unscoped().Model(&file).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore file"})
+		return
+	}
+
+	pinned := false
+	if s.Node != nil {
+		if err := s.Node.Pin(c.Request.Context(), file.CID); err != nil {
+			fmt.Printf("Warning: Failed to re-pin restored CID %s: %v\n", file.CID, err)
+		} else {
+			pinned = true
+		}
+	}
+
+	s.DB.First(&file, file.ID)
+	c.JSON(http.StatusOK, gin.H{"status": "restored", "file": file, "pinned": pinned})
+}
+
+func (s *Server) handlePurgeTrashItem(c *gin.Context) {
+	var file db.File
+	if err := s.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&file, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not in trash"})
+		return
+	}
+	if err := s.purgeFile(c.Request.Context(), file); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge file: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "purged"})
+}
+
+// handleEmptyTrash purges everything in the trash
+func (s *Server) handleEmptyTrash(c *gin.Context) {
+	var files []db.File
+	if err := s.DB.Unscoped().Where("deleted_at IS NOT NULL").Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trash"})
+		return
+	}
+
+	purged := 0
+	failed := make([]gin.H, 0)
+	for _, file := range files {
+		if err := s.purgeFile(c.Request.Context(), file); err != nil {
+			failed = append(failed, gin.H{"id": file.ID, "cid": file.CID, "error": err.Error()})
+			continue
+		}
+		purged++
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "emptied", "purged": purged, "failed": failed})
+}
@@ -10,7 +10,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"strings"
 	"sync"
+	"time"
 
 	"mochibox-core/crypto"
 	"mochibox-core/db"
@@ -18,6 +21,14 @@ import (
 	"gorm.io/gorm"
 )
 
+var errInvalidPassword = errors.New("invalid password")
+
+// Returned by Unlock and ExportMnemonic for accounts using a BIP39 passphrase
+var (
+	ErrPassphraseRequired = errors.New("passphrase required")
+	ErrInvalidPassphrase  = errors.New("invalid passphrase")
+)
+
 type AccountManager struct {
 	DB      *gorm.DB
 	DataDir string
@@ -25,6 +36,9 @@ type AccountManager struct {
 	// In-memory wallet (unlocked)
 	Wallet *crypto.Wallet
 	Mutex  sync.RWMutex
+
+	// Keys of every identity, for private-mode decryption (unlocked only)
+	identities []identityKey
 }
 
 func NewAccountManager(database *gorm.DB, dataDir string) *AccountManager {
@@ -55,39 +69,27 @@ func (m *AccountManager) GetProfile() (*db.Account, error) {
 		return nil, err
 	}
 	acc.IsInitialized = true
+	m.applyActiveIdentity(&acc)
 	return &acc, nil
 }
 
-// InitAccount creates a new account
-func (m *AccountManager) InitAccount(mnemonic, password, name string) error {
+// InitAccount creates a new account. passphrase is the optional BIP39
+// passphrase; only whether one is used is recorded.
+func (m *AccountManager) InitAccount(mnemonic, password, name, passphrase string) error {
 	m.Mutex.Lock()
 	defer m.Mutex.Unlock()
 
 	// 1. Recover Wallet from Mnemonic
-	wallet, err := crypto.RecoverWallet(mnemonic)
+	wallet, err := crypto.RecoverWallet(mnemonic, passphrase)
 	if err != nil {
 		return err
 	}
 
 	// 2. Encrypt Seed with Password
-	// Generate Salt for KDF
-	salt, err := crypto.GenerateSalt(16)
+	encryptedSeed, salt, err := sealSeed(mnemonic, password)
 	if err != nil {
 		return err
 	}
-	
-	// Derive Key
-	key := crypto.DeriveKey(password, salt)
-
-	// Encrypt Mnemonic (AES-GCM)
-	block, _ := aes.NewCipher(key)
-	gcm, _ := cipher.NewGCM(block)
-	nonce := make([]byte, gcm.NonceSize())
-	io.ReadFull(rand.Reader, nonce)
-	encryptedData := gcm.Seal(nil, nonce, []byte(mnemonic), nil)
-	
-	// Store nonce + ciphertext
-	fullBlob := append(nonce, encryptedData...)
 
 	// 3. Save to DB
 	// Clear existing if any (reset)
@@ -97,21 +99,26 @@ func (m *AccountManager) InitAccount(mnemonic, password, name string) error {
 		PublicKey:     hex.EncodeToString(wallet.PublicKey),
 		Name:          name,
 		Avatar:        fmt.Sprintf("https://api.dicebear.com/7.x/identicon/svg?seed=%s", hex.EncodeToString(wallet.PublicKey)),
-		EncryptedSeed: base64.StdEncoding.EncodeToString(fullBlob),
-		Salt:          hex.EncodeToString(salt),
+		EncryptedSeed: encryptedSeed,
+		Salt:          salt,
+		HasPassphrase: passphrase != "",
 	}
 
 	if err := m.DB.Create(&acc).Error; err != nil {
 		return err
 	}
+	m.DB.Exec("DELETE FROM identities")
+	if err := m.activateIdentities(&acc, wallet); err != nil {
+		return err
+	}
 
 	// Set as unlocked
 	m.Wallet = wallet
 	return nil
 }
 
-// Unlock unlocks the account
-func (m *AccountManager) Unlock(password string) error {
+// Unlock unlocks the account. passphrase is required if the account uses one.
+func (m *AccountManager) Unlock(password, passphrase string) error {
 	m.Mutex.Lock()
 	defer m.Mutex.Unlock()
 
@@ -120,42 +127,212 @@ func (m *AccountManager) Unlock(password string) error {
 		return errors.New("no account found")
 	}
 
-	// 1. Decode Salt and EncryptedSeed
-	salt, _ := hex.DecodeString(acc.Salt)
-	blob, _ := base64.StdEncoding.DecodeString(acc.EncryptedSeed)
+	// 1. Decrypt Seed
+	mnemonic, params, err := openSeed(&acc, password)
+	if err != nil {
+		return err
+	}
 
-	// 2. Derive Key
-	key := crypto.DeriveKey(password, salt)
+	// 2. Reconstruct Wallet
+	wallet, err := recoverAccountWallet(&acc, mnemonic, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := m.activateIdentities(&acc, wallet); err != nil {
+		return err
+	}
+
+	m.Wallet = wallet
+
+	// 3. Rehash with the current KDF params if the stored ones are weaker.
+	// Failure only leaves the old (still valid) record in place.
+	if params.Weaker(crypto.DefaultKDFParams) {
+		if encryptedSeed, salt, err := sealSeed(mnemonic, password); err == nil {
+			acc.EncryptedSeed = encryptedSeed
+			acc.Salt = salt
+			if err := m.DB.Save(&acc).Error; err != nil {
+				log.Printf("Account: failed to upgrade KDF params: %v", err)
+			}
+		}
+	}
+	
+	return nil
+}
+
+// recoverAccountWallet rebuilds the wallet and checks it is the account's
+// identity, which is how a wrong or missing BIP39 passphrase shows up
+func recoverAccountWallet(acc *db.Account, mnemonic, passphrase string) (*crypto.Wallet, error) {
+	if !acc.HasPassphrase {
+		passphrase = ""
+	} else if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+
+	wallet, err := crypto.RecoverWallet(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(hex.EncodeToString(wallet.PublicKey), acc.PublicKey) {
+		return nil, ErrInvalidPassphrase
+	}
+	return wallet, nil
+}
+
+// sealSeed encrypts the mnemonic (AES-GCM) under a key derived from password
+// with DefaultKDFParams. It returns the base64 nonce+ciphertext and the encoded salt.
+func sealSeed(mnemonic, password string) (string, string, error) {
+	salt, err := crypto.NewKDFSalt()
+	if err != nil {
+		return "", "", err
+	}
+	key, err := crypto.DeriveKeyFromSalt(password, salt)
+	if err != nil {
+		return "", "", err
+	}
 
-	// 3. Decrypt
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return err
+		return "", "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", "", err
+	}
+	encryptedData := gcm.Seal(nil, nonce, []byte(mnemonic), nil)
+
+	// Store nonce + ciphertext
+	fullBlob := append(nonce, encryptedData...)
+	return base64.StdEncoding.EncodeToString(fullBlob), salt, nil
+}
+
+// openSeed decrypts the account mnemonic and reports the KDF params it was sealed with
+func openSeed(acc *db.Account, password string) (string, crypto.KDFParams, error) {
+	salt, params, err := crypto.ParseKDFSalt(acc.Salt)
+	if err != nil {
+		return "", params, err
+	}
+	mnemonic, err := openSeedWithKey(acc, params.DeriveKey(password, salt))
+	return mnemonic, params, err
+}
+
+// openSeedWithKey decrypts the account mnemonic with an already derived seed key
+func openSeedWithKey(acc *db.Account, key []byte) (string, error) {
+	blob, _ := base64.StdEncoding.DecodeString(acc.EncryptedSeed)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
 	}
 
 	nonceSize := gcm.NonceSize()
 	if len(blob) < nonceSize {
-		return errors.New("invalid encrypted data")
+		return "", errors.New("invalid encrypted data")
 	}
 
 	nonce, ciphertext := blob[:nonceSize], blob[nonceSize:]
 	mnemonicBytes, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return errors.New("invalid password")
+		return "", errInvalidPassword
+	}
+	return string(mnemonicBytes), nil
+}
+
+// DeriveUnlockToken returns the seed key for password, for storing in auth.lock
+// instead of the password itself. It changes whenever the salt does (password
+// change, KDF upgrade), which invalidates old tokens.
+func (m *AccountManager) DeriveUnlockToken(password string) ([]byte, error) {
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+
+	var acc db.Account
+	if err := m.DB.First(&acc).Error; err != nil {
+		return nil, errors.New("no account found")
+	}
+	// The token alone cannot rebuild a passphrase-protected wallet
+	if acc.HasPassphrase {
+		return nil, errors.New("remember me is unavailable with a BIP39 passphrase")
 	}
 
-	// 4. Reconstruct Wallet
-	wallet, err := crypto.RecoverWallet(string(mnemonicBytes))
+	salt, params, err := crypto.ParseKDFSalt(acc.Salt)
+	if err != nil {
+		return nil, err
+	}
+	key := params.DeriveKey(password, salt)
+	if _, err := openSeedWithKey(&acc, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// UnlockWithToken unlocks the account with a token from DeriveUnlockToken
+func (m *AccountManager) UnlockWithToken(token []byte) error {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	var acc db.Account
+	if err := m.DB.First(&acc).Error; err != nil {
+		return errors.New("no account found")
+	}
+
+	mnemonic, err := openSeedWithKey(&acc, token)
+	if err != nil {
+		return errors.New("invalid unlock token")
+	}
+
+	wallet, err := recoverAccountWallet(&acc, mnemonic, "")
 	if err != nil {
 		return err
 	}
+	if err := m.activateIdentities(&acc, wallet); err != nil {
+		return err
+	}
 
 	m.Wallet = wallet
-	
+	return nil
+}
+
+// SaveUnlockToken stores a "remember me" token for password in auth.lock
+func (m *AccountManager) SaveUnlockToken(password string, ttl time.Duration) error {
+	token, err := m.DeriveUnlockToken(password)
+	if err != nil {
+		return err
+	}
+	return crypto.SaveAuthLock(token, m.DataDir, ttl)
+}
+
+// AutoUnlock unlocks from auth.lock if present. Lock files still holding the
+// raw password are replaced with a token on success.
+func (m *AccountManager) AutoUnlock(ttl time.Duration) error {
+	secret, err := crypto.LoadAuthLock(m.DataDir)
+	if err != nil {
+		return err
+	}
+
+	if secret.LegacyPassword != nil {
+		password := string(secret.LegacyPassword)
+		if err := m.Unlock(password, ""); err != nil {
+			return err
+		}
+		if err := m.SaveUnlockToken(password, ttl); err != nil {
+			log.Printf("Account: failed to migrate auth lock: %v", err)
+			crypto.ClearAuthLock(m.DataDir)
+		}
+		return nil
+	}
+
+	if err := m.UnlockWithToken(secret.Token); err != nil {
+		// Stale token (password changed or KDF upgraded); stop retrying it
+		crypto.ClearAuthLock(m.DataDir)
+		return err
+	}
 	return nil
 }
 
@@ -164,6 +341,7 @@ func (m *AccountManager) Lock() {
 	m.Mutex.Lock()
 	defer m.Mutex.Unlock()
 	m.Wallet = nil
+	m.identities = nil
 }
 
 // Reset deletes the account and lock file
@@ -173,11 +351,13 @@ func (m *AccountManager) Reset() error {
     
     // Clear Wallet
     m.Wallet = nil
+    m.identities = nil
     
     // Delete from DB
     if err := m.DB.Exec("DELETE FROM accounts").Error; err != nil {
         return err
     }
+    m.DB.Exec("DELETE FROM identities")
     
     // Clear Lock File
     crypto.ClearAuthLock(m.DataDir)
@@ -197,6 +377,18 @@ func (m *AccountManager) Sign(data []byte) ([]byte, error) {
 	return m.Wallet.Sign(data), nil
 }
 
+// PublicKeyHex returns the active identity's public key
+func (m *AccountManager) PublicKeyHex() (string, error) {
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+
+	if m.Wallet == nil {
+		return "", errors.New("wallet locked")
+	}
+
+	return hex.EncodeToString(m.Wallet.PublicKey), nil
+}
+
 // Verify verifies a signature
 func (m *AccountManager) Verify(data, signature, publicKey []byte) bool {
 	if len(publicKey) != ed25519.PublicKeySize {
@@ -205,54 +397,88 @@ func (m *AccountManager) Verify(data, signature, publicKey []byte) bool {
 	return ed25519.Verify(publicKey, data, signature)
 }
 
-// DecryptBox decrypts a sealed box using the account's private key
+// DecryptBox decrypts a sealed box addressed to any of the account's
+// identities, trying the active one first
 func (m *AccountManager) DecryptBox(encrypted []byte) ([]byte, error) {
+	keys := m.unlockedKeys()
+	if len(keys) == 0 {
+		return nil, errors.New("wallet locked")
+	}
+
+	for _, k := range keys {
+		// Sealed boxes use X25519; convert the Ed25519 keypair
+		privKey, err := crypto.Ed25519PrivateKeyToCurve25519(k.Key)
+		if err != nil {
+			continue
+		}
+		pubKey, err := crypto.Ed25519PublicKeyToCurve25519(k.Key.Public().(ed25519.PublicKey))
+		if err != nil {
+			continue
+		}
+		var pubKeyArr, privKeyArr [32]byte
+		copy(pubKeyArr[:], pubKey)
+		copy(privKeyArr[:], privKey)
+		if plain, err := crypto.DecryptBoxAnonymous(encrypted, &pubKeyArr, &privKeyArr); err == nil {
+			return plain, nil
+		}
+	}
+	return nil, errors.New("no identity can open this box")
+}
+
+// unlockedKeys returns the keys of every identity, the active one first, or
+// nothing while locked
+func (m *AccountManager) unlockedKeys() []identityKey {
 	m.Mutex.RLock()
 	defer m.Mutex.RUnlock()
 
 	if m.Wallet == nil {
-		return nil, errors.New("wallet locked")
+		return nil
+	}
+	active := identityKey{PublicHex: hex.EncodeToString(m.Wallet.PublicKey), Key: m.Wallet.PrivateKey}
+	keys := []identityKey{active}
+	for _, k := range m.identities {
+		if !strings.EqualFold(k.PublicHex, active.PublicHex) {
+			keys = append(keys, k)
+		}
 	}
+	return keys
+}
 
-	// 1. Convert Ed25519 Private Key -> X25519 Private Key
-	privKey, err := crypto.Ed25519PrivateKeyToCurve25519(m.Wallet.PrivateKey)
+// OpenSessionKey recovers the session key of a private file from its EncryptionMeta,
+// using the recipient entry addressed to any of the account's identities.
+func (m *AccountManager) OpenSessionKey(meta string) ([]byte, error) {
+	recipients, err := crypto.DecodeRecipientKeys(meta)
 	if err != nil {
 		return nil, err
 	}
-	
-	// 2. Open Box
-	// golang.org/x/crypto/nacl/box.OpenAnonymous expects:
-	// out, box, publicKey, privateKey
-	// SealAnonymous prepends the ephemeral public key to the ciphertext.
-	// OpenAnonymous handles reading that.
-	
-	// We need to pass the receiver's public key (our public key) as the 3rd arg?
-	// box.OpenAnonymous(out, box, publicKey, privateKey)
-	// publicKey here is the Sender's public key. But for Anonymous seal, the sender is ephemeral.
-	// Actually, OpenAnonymous takes: (out, box, publicKey, privateKey)
-	// "The publicKey argument is the public key of the recipient." -> Wait, doc says:
-	// "OpenAnonymous opens a box sealed by SealAnonymous. It returns the plaintext... publicKey is the public key of the recipient..."
-	
-	// Let's check `box` package docs or usage.
-	// SealAnonymous(out, message, recipient, rand) -> returns ephemeralPub + encryptedMsg
-	// OpenAnonymous(out, box, recipientPub, recipientPriv) -> expects box to contain ephemeralPub
-	
-	// So we need our Curve25519 Public Key too.
-	pubKey, err := crypto.Ed25519PublicKeyToCurve25519(m.Wallet.PublicKey)
-	if err != nil {
-		return nil, err
+
+	keys := m.unlockedKeys()
+	if len(keys) == 0 {
+		return nil, errors.New("wallet locked")
 	}
-	
-	var pubKeyArr [32]byte
-	var privKeyArr [32]byte
-	copy(pubKeyArr[:], pubKey)
-	copy(privKeyArr[:], privKey)
-	
-	return crypto.DecryptBoxAnonymous(encrypted, &pubKeyArr, &privKeyArr)
+
+	for _, r := range recipients {
+		encKey, err := base64.StdEncoding.DecodeString(r.EncryptedKey)
+		if err != nil {
+			continue
+		}
+		for _, k := range keys {
+			// Entries for other keys cannot open with ours; legacy entries carry no key
+			if r.PubKey != "" && !strings.EqualFold(r.PubKey, k.PublicHex) {
+				continue
+			}
+			w := &crypto.Wallet{PrivateKey: k.Key, PublicKey: k.Key.Public().(ed25519.PublicKey)}
+			if sessionKey, err := w.DecryptSessionKey(encKey); err == nil {
+				return sessionKey, nil
+			}
+		}
+	}
+	return nil, errors.New("no session key for this account")
 }
 
-// ExportMnemonic validates password and returns mnemonic
-func (m *AccountManager) ExportMnemonic(password string) (string, error) {
+// ExportMnemonic validates password (and the BIP39 passphrase, if the account
+// uses one) and returns mnemonic. The passphrase itself is never returned.
+func (m *AccountManager) ExportMnemonic(password, passphrase string) (string, error) {
     m.Mutex.RLock()
     defer m.Mutex.RUnlock()
     
@@ -265,32 +491,25 @@ func (m *AccountManager) ExportMnemonic(password string) (string, error) {
         return "", errors.New("no account found")
     }
 
-    salt, _ := hex.DecodeString(acc.Salt)
-    blob, _ := base64.StdEncoding.DecodeString(acc.EncryptedSeed)
-
-    key := crypto.DeriveKey(password, salt)
-
-    block, err := aes.NewCipher(key)
+    mnemonic, _, err := openSeed(&acc, password)
     if err != nil {
         return "", err
     }
-    gcm, err := cipher.NewGCM(block)
-    if err != nil {
+    if _, err := recoverAccountWallet(&acc, mnemonic, passphrase); err != nil {
         return "", err
     }
+    
+    return mnemonic, nil
+}
 
-    nonceSize := gcm.NonceSize()
-    if len(blob) < nonceSize {
-        return "", errors.New("invalid encrypted data")
-    }
-
-    nonce, ciphertext := blob[:nonceSize], blob[nonceSize:]
-    mnemonicBytes, err := gcm.Open(nil, nonce, ciphertext, nil)
+// ExportMnemonicShares validates password and splits the mnemonic into n
+// backup shares, any threshold of which recover it
+func (m *AccountManager) ExportMnemonicShares(password, passphrase string, n, threshold int) ([]string, error) {
+    mnemonic, err := m.ExportMnemonic(password, passphrase)
     if err != nil {
-        return "", errors.New("invalid password")
+        return nil, err
     }
-    
-    return string(mnemonicBytes), nil
+    return crypto.SplitMnemonic(mnemonic, n, threshold)
 }
 
 // ChangePassword re-encrypts the mnemonic with a new password
@@ -304,52 +523,23 @@ func (m *AccountManager) ChangePassword(oldPassword, newPassword string) error {
         return errors.New("no account found")
     }
 
-    salt, _ := hex.DecodeString(acc.Salt)
-    blob, _ := base64.StdEncoding.DecodeString(acc.EncryptedSeed)
-
-    key := crypto.DeriveKey(oldPassword, salt)
-
-    block, err := aes.NewCipher(key)
-    if err != nil {
-        return err
-    }
-    gcm, err := cipher.NewGCM(block)
+    mnemonic, _, err := openSeed(&acc, oldPassword)
     if err != nil {
+        if errors.Is(err, errInvalidPassword) {
+            return errors.New("invalid old password")
+        }
         return err
     }
-
-    nonceSize := gcm.NonceSize()
-    if len(blob) < nonceSize {
-        return errors.New("invalid encrypted data")
-    }
-
-    nonce, ciphertext := blob[:nonceSize], blob[nonceSize:]
-    mnemonicBytes, err := gcm.Open(nil, nonce, ciphertext, nil)
-    if err != nil {
-        return errors.New("invalid old password")
-    }
-    
-    mnemonic := string(mnemonicBytes)
     
     // 2. Encrypt with New Password
-    newSalt, err := crypto.GenerateSalt(16)
+    encryptedSeed, newSalt, err := sealSeed(mnemonic, newPassword)
     if err != nil {
         return err
     }
     
-    newKey := crypto.DeriveKey(newPassword, newSalt)
-    
-    block, _ = aes.NewCipher(newKey)
-    gcm, _ = cipher.NewGCM(block)
-    newNonce := make([]byte, gcm.NonceSize())
-    io.ReadFull(rand.Reader, newNonce)
-    encryptedData := gcm.Seal(nil, newNonce, []byte(mnemonic), nil)
-    
-    fullBlob := append(newNonce, encryptedData...)
-    
     // 3. Update DB
-    acc.EncryptedSeed = base64.StdEncoding.EncodeToString(fullBlob)
-    acc.Salt = hex.EncodeToString(newSalt)
+    acc.EncryptedSeed = encryptedSeed
+    acc.Salt = newSalt
     
     if err := m.DB.Save(&acc).Error; err != nil {
         return err
@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -21,8 +22,9 @@ func NewEncryptedDownloader(pd *ParallelDownloader) *EncryptedDownloader {
 
 // DownloadAndDecrypt downloads an encrypted file and decrypts it with the provided key
 // The key should already be derived (from password+salt or decrypted session key)
-// File format: [16B IV][AES-CTR encrypted data]
-func (ed *EncryptedDownloader) DownloadAndDecrypt(ctx context.Context, cid string, key []byte, dst io.Writer, progressCallback func(downloaded int64)) error {
+// File format: v2 chunked AEAD container, or legacy [16B IV][AES-CTR encrypted data]
+// metadataCallback (optional) receives the sealed metadata envelope before any data is written
+func (ed *EncryptedDownloader) DownloadAndDecrypt(ctx context.Context, cid string, key []byte, dst io.Writer, progressCallback func(downloaded int64), metadataCallback func(meta *crypto.FileMetadata)) error {
 	if ed.parallelDownloader == nil {
 		return fmt.Errorf("parallel downloader not initialized")
 	}
@@ -46,19 +48,35 @@ func (ed *EncryptedDownloader) DownloadAndDecrypt(ctx context.Context, cid strin
 	}()
 
 	// Stream decrypt from pipe reader to destination
-	// File format is [16B IV][encrypted data], matching NewAESCTRDecrypter expectations
-	decryptReader, err := crypto.NewAESCTRDecrypter(pr, key)
+	// NewDecryptReader picks the format from the header; container chunks are
+	// authenticated as they arrive, so tampering surfaces as ErrAuthFailed
+	decryptReader, err := crypto.NewDecryptReader(pr, key)
 	if err != nil {
+		pr.CloseWithError(err)
+		<-downloadDone
 		return fmt.Errorf("failed to create decrypt stream: %w", err)
 	}
 
+	if mr, ok := decryptReader.(crypto.MetadataReader); ok && metadataCallback != nil {
+		if meta := mr.Metadata(); meta != nil {
+			metadataCallback(meta)
+		}
+	}
+
 	// Copy decrypted data to destination
 	_, copyErr := io.Copy(dst, decryptReader)
+	if copyErr != nil {
+		// Unblock the downloader if decryption stopped early
+		pr.CloseWithError(copyErr)
+	}
 
 	// Wait for download to complete
 	downloadErr := <-downloadDone
 
-	// Return first error encountered
+	// Return first error encountered; a failed chunk also aborts the download
+	if errors.Is(copyErr, crypto.ErrAuthFailed) {
+		return fmt.Errorf("decryption failed: %w", copyErr)
+	}
 	if downloadErr != nil {
 		return fmt.Errorf("download failed: %w", downloadErr)
 	}
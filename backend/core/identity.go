@@ -0,0 +1,189 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mochibox-core/crypto"
+	"mochibox-core/db"
+)
+
+// RootIdentityName names the identity that existed before derived identities
+const RootIdentityName = "default"
+
+// identityKey is an unlocked identity keypair
+type identityKey struct {
+	ID        uint
+	PublicHex string
+	Key       ed25519.PrivateKey
+}
+
+// activateIdentities derives the key of every identity of the account and makes
+// the active one the wallet's key. Accounts created before identities get a
+// root identity for their original key. Callers hold m.Mutex.
+func (m *AccountManager) activateIdentities(acc *db.Account, wallet *crypto.Wallet) error {
+	var identities []db.Identity
+	if err := m.DB.Order("id").Find(&identities).Error; err != nil {
+		return err
+	}
+	if len(identities) == 0 {
+		root := db.Identity{
+			Name:      RootIdentityName,
+			Root:      true,
+			PublicKey: acc.PublicKey,
+			CreatedAt: time.Now(),
+		}
+		if err := m.DB.Create(&root).Error; err != nil {
+			return err
+		}
+		identities = append(identities, root)
+	}
+
+	rootKey := wallet.RootKey()
+	active := rootKey
+	keys := make([]identityKey, 0, len(identities))
+	for _, id := range identities {
+		key := rootKey
+		if !id.Root {
+			derived, err := wallet.DeriveIdentityKey(id.Index)
+			if err != nil {
+				return err
+			}
+			key = derived
+		}
+		keys = append(keys, identityKey{ID: id.ID, PublicHex: id.PublicKey, Key: key})
+		if id.ID == acc.ActiveIdentityID {
+			active = key
+		}
+	}
+
+	wallet.UseKey(active)
+	m.identities = keys
+	return nil
+}
+
+// ListIdentities returns all identities of the account
+func (m *AccountManager) ListIdentities() ([]db.Identity, error) {
+	var identities []db.Identity
+	if err := m.DB.Order("id").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// CreateIdentity derives a new identity at the next free index
+func (m *AccountManager) CreateIdentity(name string) (*db.Identity, error) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	if m.Wallet == nil {
+		return nil, errors.New("wallet locked")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("identity name required")
+	}
+
+	var count int64
+	m.DB.Model(&db.Identity{}).Where("name = ?", name).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("identity %q already exists", name)
+	}
+
+	var next uint32
+	var derived []db.Identity
+	m.DB.Where("root = ?", false).Find(&derived)
+	for _, id := range derived {
+		if id.Index >= next {
+			next = id.Index + 1
+		}
+	}
+
+	key, err := m.Wallet.DeriveIdentityKey(next)
+	if err != nil {
+		return nil, err
+	}
+	pubHex := hex.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	identity := db.Identity{
+		Name:      name,
+		Index:     next,
+		PublicKey: pubHex,
+		CreatedAt: time.Now(),
+	}
+	if err := m.DB.Create(&identity).Error; err != nil {
+		return nil, err
+	}
+
+	m.identities = append(m.identities, identityKey{ID: identity.ID, PublicHex: pubHex, Key: key})
+	return &identity, nil
+}
+
+// SwitchIdentity makes identity id the active signing and decryption key
+func (m *AccountManager) SwitchIdentity(id uint) error {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	if m.Wallet == nil {
+		return errors.New("wallet locked")
+	}
+
+	for _, ik := range m.identities {
+		if ik.ID != id {
+			continue
+		}
+		if err := m.DB.Model(&db.Account{}).Where("1 = 1").Update("active_identity_id", id).Error; err != nil {
+			return err
+		}
+		m.Wallet.UseKey(ik.Key)
+		return nil
+	}
+	return errors.New("identity not found")
+}
+
+// applyActiveIdentity shows the active identity's key and avatar on a profile
+func (m *AccountManager) applyActiveIdentity(acc *db.Account) {
+	if acc.ActiveIdentityID == 0 {
+		acc.Identity = RootIdentityName
+		return
+	}
+	var identity db.Identity
+	if err := m.DB.First(&identity, acc.ActiveIdentityID).Error; err != nil {
+		return
+	}
+	acc.Identity = identity.Name
+	if !identity.Root {
+		acc.PublicKey = identity.PublicKey
+		acc.Avatar = fmt.Sprintf("https://api.dicebear.com/7.x/identicon/svg?seed=%s", identity.PublicKey)
+	}
+}
+
+// FeedKey derives the IPNS key of the feed owned by the identity with public
+// key publicHex, so the feed name follows the seed rather than the IPFS node
+func (m *AccountManager) FeedKey(publicHex string) (ed25519.PrivateKey, error) {
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+
+	if m.Wallet == nil {
+		return nil, errors.New("wallet locked")
+	}
+	for _, ik := range m.identities {
+		if !strings.EqualFold(ik.PublicHex, publicHex) {
+			continue
+		}
+		var identity db.Identity
+		if err := m.DB.First(&identity, ik.ID).Error; err != nil {
+			return nil, err
+		}
+		slot := uint32(0)
+		if !identity.Root {
+			slot = identity.Index + 1
+		}
+		return m.Wallet.DeriveFeedKey(slot)
+	}
+	return nil, errors.New("identity not found")
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+
+	"mochibox-core/crypto"
+	"mochibox-core/db"
+)
+
+func TestIdentities_DeriveSwitchAndDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.InitDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewAccountManager(database, dir)
+
+	w, _ := crypto.NewWallet("")
+	if err := m.InitAccount(w.Mnemonic, "pw", "tester", ""); err != nil {
+		t.Fatalf("InitAccount: %v", err)
+	}
+	rootPub := append([]byte(nil), m.Wallet.PublicKey...)
+
+	work, err := m.CreateIdentity("work")
+	if err != nil {
+		t.Fatalf("CreateIdentity: %v", err)
+	}
+	if _, err := m.CreateIdentity("work"); err == nil {
+		t.Fatal("expected duplicate name error")
+	}
+
+	// A file sealed only to the derived identity opens without switching
+	sessionKey := bytes.Repeat([]byte{0x05}, 32)
+	recipients, _ := crypto.SealSessionKeyFor(sessionKey, []string{work.PublicKey})
+	meta, _ := crypto.EncodeRecipientKeys(recipients)
+	got, err := m.OpenSessionKey(meta)
+	if err != nil || !bytes.Equal(got, sessionKey) {
+		t.Fatalf("OpenSessionKey: %v", err)
+	}
+
+	// Saved passwords are sealed to the identity active at upload time
+	rootCurve, _ := crypto.Ed25519PublicKeyToCurve25519(rootPub)
+	savedPassword, _ := crypto.EncryptSessionKey(rootCurve, []byte("hunter2"))
+
+	if err := m.SwitchIdentity(work.ID); err != nil {
+		t.Fatalf("SwitchIdentity: %v", err)
+	}
+	profile, _ := m.GetProfile()
+	if profile.PublicKey != work.PublicKey || profile.Identity != "work" {
+		t.Fatalf("profile not switched: %+v", profile)
+	}
+	if plain, err := m.DecryptBox(savedPassword); err != nil || string(plain) != "hunter2" {
+		t.Fatalf("DecryptBox after switching identity: %q, %v", plain, err)
+	}
+
+	// Each identity has its own feed key, derived from the seed
+	workFeed, err := m.FeedKey(work.PublicKey)
+	if err != nil {
+		t.Fatalf("FeedKey: %v", err)
+	}
+	rootFeed, _ := m.FeedKey(hex.EncodeToString(rootPub))
+	if want, _ := w.DeriveFeedKey(work.Index + 1); !bytes.Equal(workFeed, want) || bytes.Equal(workFeed, rootFeed) {
+		t.Fatal("feed keys must follow the identity's seed slot")
+	}
+
+	// The active identity survives a lock/unlock cycle
+	m.Lock()
+	if err := m.Unlock("pw", ""); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	profile, _ = m.GetProfile()
+	if profile.PublicKey != work.PublicKey || bytes.Equal(m.Wallet.PublicKey, rootPub) {
+		t.Fatal("active identity lost after unlock")
+	}
+}
@@ -2,11 +2,15 @@ package core
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
 	"fmt"
 	"io"
 	"sort"
 	"strings"
+	"time"
 
 	// files "github.com/ipfs/go-ipfs-files"
 	// kuborpc "github.com/ipfs/kubo/client/rpc"
@@ -25,6 +29,7 @@ import (
 	"github.com/ipfs/boxo/path"
 	"github.com/multiformats/go-multiaddr"
     "github.com/libp2p/go-libp2p/core/peer"
+    p2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
 	"os"
 )
 
@@ -528,3 +533,184 @@ func (n *MochiNode) PeeringAdd(ctx context.Context, addr string) error {
 	// Implementing full Peering via config requires parsing the current config, adding to list, and saving.
 	return n.Connect(ctx, addr)
 }
+
+// Publish sends data on a pubsub topic (requires --enable-pubsub-experiment)
+func (n *MochiNode) Publish(ctx context.Context, topic string, data []byte) error {
+	if n.IPFS == nil {
+		return fmt.Errorf("IPFS client not initialized")
+	}
+	return n.IPFS.PubSub().Publish(ctx, topic, data)
+}
+
+// PeerConnections returns the remote address of each open swarm connection, by peer
+func (n *MochiNode) PeerConnections(ctx context.Context) (map[peer.ID][]multiaddr.Multiaddr, error) {
+	if n.IPFS == nil {
+		return nil, fmt.Errorf("IPFS client not initialized")
+	}
+	conns, err := n.IPFS.Swarm().Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[peer.ID][]multiaddr.Multiaddr)
+	for _, conn := range conns {
+		result[conn.ID()] = append(result[conn.ID()], conn.Address())
+	}
+	return result, nil
+}
+
+// Subscribe listens on a pubsub topic until ctx is done or the subscription is closed
+func (n *MochiNode) Subscribe(ctx context.Context, topic string) (iface.PubSubSubscription, error) {
+	if n.IPFS == nil {
+		return nil, fmt.Errorf("IPFS client not initialized")
+	}
+	return n.IPFS.PubSub().Subscribe(ctx, topic)
+}
+
+// ExportCAR streams the DAG under a CID as a CARv1 (ipfs dag export)
+func (n *MochiNode) ExportCAR(ctx context.Context, cidStr string) (io.ReadCloser, error) {
+	rpc, ok := n.IPFS.(*kuborpc.HttpApi)
+	if !ok {
+		return nil, fmt.Errorf("IPFS client does not support dag export")
+	}
+	resp, err := rpc.Request("dag/export", cidStr).Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		resp.Close()
+		return nil, resp.Error
+	}
+	return resp.Output, nil
+}
+
+// ImportCAR imports the blocks of a CAR stream, pins the roots listed in its
+// header and returns them (ipfs dag import --pin-roots)
+func (n *MochiNode) ImportCAR(ctx context.Context, r io.Reader) ([]string, error) {
+	rpc, ok := n.IPFS.(*kuborpc.HttpApi)
+	if !ok {
+		return nil, fmt.Errorf("IPFS client does not support dag import")
+	}
+	resp, err := rpc.Request("dag/import").Option("pin-roots", true).FileBody(r).Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	var roots []string
+	dec := json.NewDecoder(resp.Output)
+	for {
+		var event struct {
+			Root *struct {
+				Cid struct {
+					Path string `json:"/"`
+				}
+				PinErrorMsg string
+			}
+		}
+		if err := dec.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			return roots, err
+		}
+		if event.Root == nil {
+			continue
+		}
+		if event.Root.PinErrorMsg != "" {
+			return roots, fmt.Errorf("failed to pin %s: %s", event.Root.Cid.Path, event.Root.PinErrorMsg)
+		}
+		roots = append(roots, event.Root.Cid.Path)
+	}
+	return roots, nil
+}
+
+// ImportKey makes priv the node's IPNS key called name and returns its ID. A
+// different key already stored under name is replaced.
+func (n *MochiNode) ImportKey(ctx context.Context, name string, priv ed25519.PrivateKey) (string, error) {
+	if n.IPFS == nil {
+		return "", fmt.Errorf("IPFS client not initialized")
+	}
+	key, err := p2pcrypto.UnmarshalEd25519PrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := n.IPFS.Key().List(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, k := range keys {
+		if k.Name() != name {
+			continue
+		}
+		if k.ID() == id {
+			return id.String(), nil
+		}
+		if _, err := n.IPFS.Key().Remove(ctx, name); err != nil {
+			return "", err
+		}
+	}
+
+	rpcApi, ok := n.IPFS.(*kuborpc.HttpApi)
+	if !ok {
+		return "", fmt.Errorf("IPFS client cannot import keys")
+	}
+	raw, err := p2pcrypto.MarshalPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		Name string
+		Id   string
+	}
+	err = rpcApi.Request("key/import", name).
+		Option("format", "libp2p-protobuf-cleartext").
+		FileBody(bytes.NewReader(raw)).
+		Exec(ctx, &out)
+	if err != nil {
+		return "", err
+	}
+	// The node may print the ID as a base36 CID rather than a bare peer ID
+	if imported, err := peer.Decode(out.Id); err != nil || imported != id {
+		return "", fmt.Errorf("node imported key %s, expected %s", out.Id, id)
+	}
+	return id.String(), nil
+}
+
+// PublishName points the IPNS name of the named key at a CID
+func (n *MochiNode) PublishName(ctx context.Context, cidStr, keyName string, lifetime time.Duration) (string, error) {
+	if n.IPFS == nil {
+		return "", fmt.Errorf("IPFS client not initialized")
+	}
+	p, err := path.NewPath("/ipfs/" + cidStr)
+	if err != nil {
+		return "", err
+	}
+	name, err := n.IPFS.Name().Publish(ctx, p, options.Name.Key(keyName), options.Name.ValidTime(lifetime), options.Name.AllowOffline(true))
+	if err != nil {
+		return "", err
+	}
+	return name.String(), nil
+}
+
+// ResolveName resolves an IPNS name to the CID it currently points at
+func (n *MochiNode) ResolveName(ctx context.Context, name string) (string, error) {
+	if n.IPFS == nil {
+		return "", fmt.Errorf("IPFS client not initialized")
+	}
+	p, err := n.IPFS.Name().Resolve(ctx, "/ipns/"+strings.TrimPrefix(name, "/ipns/"))
+	if err != nil {
+		return "", err
+	}
+	resolved := strings.TrimPrefix(p.String(), "/ipfs/")
+	if i := strings.Index(resolved, "/"); i >= 0 {
+		resolved = resolved[:i]
+	}
+	return resolved, nil
+}
@@ -0,0 +1,520 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Container format (v2):
+//
+//	[5B magic "MOCHI"][1B version][1B cipher][1B flags][4B chunk size][16B nonce prefix]
+//	([4B length][sealed metadata envelope], when flags has flagMetadata)
+//	[sealed chunk 0][sealed chunk 1]...[sealed final chunk]
+//
+// Every chunk holds ChunkSize bytes of plaintext (the final chunk may hold
+// fewer, possibly zero) followed by a 16-byte AEAD tag. The chunk index and the
+// final-chunk flag are bound into the additional data together with the header,
+// so reordered, dropped, truncated or appended chunks all fail authentication.
+// Blobs without the magic are treated as legacy [16B IV][AES-CTR] uploads.
+
+const (
+	ContainerVersion   byte = 0x02
+	ContainerHeaderLen      = 12 + noncePrefixSize
+
+	CipherAESGCM            byte = 0x01
+	CipherXChaCha20Poly1305 byte = 0x02
+
+	DefaultChunkSize = 64 * 1024
+	maxChunkSize     = 16 * 1024 * 1024
+
+	aeadTagSize     = 16
+	noncePrefixSize = 16
+)
+
+var containerMagic = []byte("MOCHI")
+
+// ErrAuthFailed is returned when a chunk does not authenticate: wrong key,
+// tampered ciphertext or a truncated blob.
+var ErrAuthFailed = errors.New("decryption failed: wrong key or corrupted data")
+
+type containerHeader struct {
+	raw         []byte
+	cipherID    byte
+	flags       byte
+	chunkSize   int
+	noncePrefix []byte
+}
+
+// IsContainerHeader reports whether b starts with a v2 container header
+func IsContainerHeader(b []byte) bool {
+	return len(b) >= len(containerMagic)+1 &&
+		bytes.Equal(b[:len(containerMagic)], containerMagic) &&
+		b[len(containerMagic)] == ContainerVersion
+}
+
+func parseContainerHeader(raw []byte) (*containerHeader, error) {
+	if len(raw) < ContainerHeaderLen || !IsContainerHeader(raw) {
+		return nil, fmt.Errorf("invalid container header")
+	}
+	h := &containerHeader{
+		raw:         append([]byte(nil), raw[:ContainerHeaderLen]...),
+		cipherID:    raw[6],
+		flags:       raw[7],
+		chunkSize:   int(binary.BigEndian.Uint32(raw[8:12])),
+		noncePrefix: append([]byte(nil), raw[12:ContainerHeaderLen]...),
+	}
+	if h.chunkSize <= 0 || h.chunkSize > maxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size %d", h.chunkSize)
+	}
+	return h, nil
+}
+
+func newContainerAEAD(cipherID byte, key []byte) (cipher.AEAD, error) {
+	switch cipherID {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, fmt.Errorf("unsupported cipher %d", cipherID)
+	}
+}
+
+// chunkNonce builds the per-chunk nonce: the random prefix padded/truncated to
+// the AEAD nonce size, with the chunk index in the last 8 bytes.
+func chunkNonce(aead cipher.AEAD, prefix []byte, index uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, prefix[:len(nonce)-8])
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], index)
+	return nonce
+}
+
+func chunkAAD(header []byte, index uint64, final bool) []byte {
+	aad := make([]byte, len(header)+9)
+	copy(aad, header)
+	binary.BigEndian.PutUint64(aad[len(header):], index)
+	if final {
+		aad[len(aad)-1] = 1
+	}
+	return aad
+}
+
+// NewEncryptReader returns a reader producing the v2 container for src,
+// sealed with AES-256-GCM in DefaultChunkSize chunks.
+func NewEncryptReader(src io.Reader, key []byte) (io.Reader, error) {
+	return NewEncryptReaderWithOptions(src, key, CipherAESGCM, DefaultChunkSize)
+}
+
+// NewEncryptReaderWithMetadata is NewEncryptReader with an encrypted metadata
+// envelope (name, type, size, timestamps) stored ahead of the data chunks
+func NewEncryptReaderWithMetadata(src io.Reader, key []byte, meta *FileMetadata) (io.Reader, error) {
+	return newContainerEncryptReader(src, key, CipherAESGCM, DefaultChunkSize, meta)
+}
+
+// NewEncryptReaderWithOptions is NewEncryptReader with an explicit cipher and chunk size
+func NewEncryptReaderWithOptions(src io.Reader, key []byte, cipherID byte, chunkSize int) (io.Reader, error) {
+	return newContainerEncryptReader(src, key, cipherID, chunkSize, nil)
+}
+
+func newContainerEncryptReader(src io.Reader, key []byte, cipherID byte, chunkSize int, meta *FileMetadata) (io.Reader, error) {
+	if chunkSize <= 0 || chunkSize > maxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	aead, err := newContainerAEAD(cipherID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, ContainerHeaderLen)
+	copy(header, containerMagic)
+	header[5] = ContainerVersion
+	header[6] = cipherID
+	binary.BigEndian.PutUint32(header[8:12], uint32(chunkSize))
+	if _, err := io.ReadFull(rand.Reader, header[12:]); err != nil {
+		return nil, err
+	}
+
+	preamble := header
+	if meta != nil {
+		header[7] |= flagMetadata
+		sealedMeta, err := sealMetadata(aead, header, meta)
+		if err != nil {
+			return nil, err
+		}
+		preamble = append(append([]byte(nil), header...), sealedMeta...)
+	}
+
+	return &containerEncryptReader{
+		src:       src,
+		aead:      aead,
+		header:    header,
+		chunkSize: chunkSize,
+		pending:   preamble,
+		plain:     make([]byte, chunkSize+1),
+	}, nil
+}
+
+type containerEncryptReader struct {
+	src       io.Reader
+	aead      cipher.AEAD
+	header    []byte
+	chunkSize int
+
+	index   uint64
+	plain   []byte // chunkSize plaintext bytes + 1 lookahead byte
+	carry   int    // lookahead bytes already at the start of plain
+	pending []byte // sealed bytes not yet returned to the caller
+	done    bool
+}
+
+func (r *containerEncryptReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.pending) == 0 {
+			if r.done {
+				break
+			}
+			if err := r.sealNext(); err != nil {
+				return n, err
+			}
+			continue
+		}
+		m := copy(p[n:], r.pending)
+		r.pending = r.pending[m:]
+		n += m
+	}
+	if n == 0 && r.done && len(r.pending) == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (r *containerEncryptReader) sealNext() error {
+	// Read one byte past the chunk so we know whether this chunk is the last one
+	got, err := io.ReadFull(r.src, r.plain[r.carry:])
+	got += r.carry
+	final := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		final = true
+	default:
+		return err
+	}
+
+	size := got
+	if !final {
+		size = r.chunkSize
+	}
+
+	nonce := chunkNonce(r.aead, r.header[12:], r.index)
+	r.pending = r.aead.Seal(nil, nonce, r.plain[:size], chunkAAD(r.header, r.index, final))
+	r.index++
+
+	if final {
+		r.done = true
+		r.carry = 0
+	} else {
+		r.plain[0] = r.plain[r.chunkSize]
+		r.carry = 1
+	}
+	return nil
+}
+
+// NewDecryptReader returns a streaming decryptor for either format. The header
+// decides: v2 containers are authenticated chunk by chunk, anything else is read
+// as a legacy [16B IV][AES-CTR] blob.
+func NewDecryptReader(src io.Reader, key []byte) (io.Reader, error) {
+	head := make([]byte, ContainerHeaderLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return nil, ErrAuthFailed
+		}
+		return nil, err
+	}
+	head = head[:n]
+
+	if !IsContainerHeader(head) {
+		return NewAESCTRDecrypter(io.MultiReader(bytes.NewReader(head), src), key)
+	}
+
+	h, err := parseContainerHeader(head)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newContainerAEAD(h.cipherID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta *FileMetadata
+	if h.flags&flagMetadata != 0 {
+		if meta, _, err = readMetadata(src, aead, h); err != nil {
+			return nil, err
+		}
+	}
+
+	return &containerDecryptReader{
+		src:    src,
+		aead:   aead,
+		header: h,
+		meta:   meta,
+		sealed: make([]byte, h.chunkSize+aeadTagSize+1),
+	}, nil
+}
+
+type containerDecryptReader struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	header *containerHeader
+	meta   *FileMetadata
+
+	index   uint64
+	sealed  []byte // one sealed chunk + 1 lookahead byte
+	carry   int
+	pending []byte
+	done    bool
+	err     error
+}
+
+// Metadata returns the decrypted envelope, or nil if the container has none
+func (r *containerDecryptReader) Metadata() *FileMetadata {
+	return r.meta
+}
+
+func (r *containerDecryptReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.openNext()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *containerDecryptReader) openNext() error {
+	got, err := io.ReadFull(r.src, r.sealed[r.carry:])
+	got += r.carry
+	final := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		final = true
+	default:
+		return err
+	}
+
+	sealedLen := got
+	if !final {
+		sealedLen = r.header.chunkSize + aeadTagSize
+	}
+	if sealedLen < aeadTagSize {
+		return ErrAuthFailed
+	}
+
+	nonce := chunkNonce(r.aead, r.header.noncePrefix, r.index)
+	plain, err := r.aead.Open(nil, nonce, r.sealed[:sealedLen], chunkAAD(r.header.raw, r.index, final))
+	if err != nil {
+		return ErrAuthFailed
+	}
+	r.pending = plain
+	r.index++
+
+	if final {
+		r.done = true
+	} else {
+		r.sealed[0] = r.sealed[sealedLen]
+		r.carry = 1
+	}
+	return nil
+}
+
+// SeekableContainerDecrypter supports random access decryption of a v2 container
+type SeekableContainerDecrypter struct {
+	src        io.ReadSeeker
+	aead       cipher.AEAD
+	header     *containerHeader
+	meta       *FileMetadata
+	dataStart  int64 // Physical offset of chunk 0
+	chunkCount int64
+	size       int64 // Logical (plaintext) size
+	offset     int64
+
+	cachedIndex int64
+	cached      []byte
+}
+
+// NewSeekableDecrypter returns a seekable decryptor for either format and the
+// plaintext size. physSize is the size of the encrypted blob; when it is not
+// known (<= 0) it is taken from the source by seeking to the end.
+func NewSeekableDecrypter(src io.ReadSeeker, key []byte, physSize int64) (io.ReadSeeker, int64, error) {
+	if physSize <= 0 {
+		end, err := src.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, err
+		}
+		physSize = end
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	head := make([]byte, ContainerHeaderLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, 0, err
+	}
+	head = head[:n]
+
+	if !IsContainerHeader(head) {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		dec, err := NewSeekableAESCTRDecrypter(src, key, physSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		return dec, physSize - int64(aes.BlockSize), nil
+	}
+
+	h, err := parseContainerHeader(head)
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := newContainerAEAD(h.cipherID, key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dataStart := int64(ContainerHeaderLen)
+	var meta *FileMetadata
+	if h.flags&flagMetadata != 0 {
+		var metaLen int64
+		if meta, metaLen, err = readMetadata(src, aead, h); err != nil {
+			return nil, 0, err
+		}
+		dataStart += metaLen
+	}
+
+	body := physSize - dataStart
+	sealedChunk := int64(h.chunkSize + aeadTagSize)
+	chunks := (body + sealedChunk - 1) / sealedChunk
+	if chunks == 0 {
+		return nil, 0, ErrAuthFailed
+	}
+	lastSealed := body - (chunks-1)*sealedChunk
+	if lastSealed < aeadTagSize {
+		return nil, 0, ErrAuthFailed
+	}
+
+	d := &SeekableContainerDecrypter{
+		src:         src,
+		aead:        aead,
+		header:      h,
+		meta:        meta,
+		dataStart:   dataStart,
+		chunkCount:  chunks,
+		size:        body - chunks*aeadTagSize,
+		cachedIndex: -1,
+	}
+
+	// Authenticate the first chunk up front so a wrong key fails before any
+	// bytes are served.
+	if err := d.loadChunk(0); err != nil {
+		return nil, 0, err
+	}
+	return d, d.size, nil
+}
+
+func (d *SeekableContainerDecrypter) loadChunk(index int64) error {
+	if index == d.cachedIndex {
+		return nil
+	}
+	sealedChunk := int64(d.header.chunkSize + aeadTagSize)
+	final := index == d.chunkCount-1
+	sealedLen := sealedChunk
+	if final {
+		sealedLen = d.size - index*int64(d.header.chunkSize) + aeadTagSize
+	}
+
+	if _, err := d.src.Seek(d.dataStart+index*sealedChunk, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, sealedLen)
+	if _, err := io.ReadFull(d.src, buf); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return ErrAuthFailed
+		}
+		return err
+	}
+
+	nonce := chunkNonce(d.aead, d.header.noncePrefix, uint64(index))
+	plain, err := d.aead.Open(buf[:0], nonce, buf, chunkAAD(d.header.raw, uint64(index), final))
+	if err != nil {
+		return ErrAuthFailed
+	}
+	d.cached = plain
+	d.cachedIndex = index
+	return nil
+}
+
+func (d *SeekableContainerDecrypter) Read(p []byte) (int, error) {
+	if d.offset >= d.size {
+		return 0, io.EOF
+	}
+	chunkSize := int64(d.header.chunkSize)
+	index := d.offset / chunkSize
+	if err := d.loadChunk(index); err != nil {
+		return 0, err
+	}
+	n := copy(p, d.cached[d.offset-index*chunkSize:])
+	d.offset += int64(n)
+	return n, nil
+}
+
+func (d *SeekableContainerDecrypter) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = d.offset + offset
+	case io.SeekEnd:
+		abs = d.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence")
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position")
+	}
+	d.offset = abs
+	return abs, nil
+}
+
+// Metadata returns the decrypted envelope, or nil if the container has none
+func (d *SeekableContainerDecrypter) Metadata() *FileMetadata {
+	return d.meta
+}
+
+// Size returns the plaintext size
+func (d *SeekableContainerDecrypter) Size() int64 {
+	return d.size
+}
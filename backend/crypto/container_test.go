@@ -0,0 +1,228 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func sealContainer(t *testing.T, plain, key []byte, cipherID byte, chunkSize int) []byte {
+	t.Helper()
+	r, err := NewEncryptReaderWithOptions(bytes.NewReader(plain), key, cipherID, chunkSize)
+	if err != nil {
+		t.Fatalf("NewEncryptReaderWithOptions: %v", err)
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll(enc): %v", err)
+	}
+	return sealed
+}
+
+func TestContainer_RoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{0x07}, 32)
+	for _, cipherID := range []byte{CipherAESGCM, CipherXChaCha20Poly1305} {
+		for _, size := range []int{0, 1, 63, 64, 65, 128, 1000} {
+			plain := make([]byte, size)
+			rand.Read(plain)
+			sealed := sealContainer(t, plain, key, cipherID, 64)
+
+			dec, err := NewDecryptReader(bytes.NewReader(sealed), key)
+			if err != nil {
+				t.Fatalf("NewDecryptReader(cipher=%d,size=%d): %v", cipherID, size, err)
+			}
+			got, err := io.ReadAll(dec)
+			if err != nil {
+				t.Fatalf("ReadAll(dec cipher=%d,size=%d): %v", cipherID, size, err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatalf("stream mismatch (cipher=%d,size=%d)", cipherID, size)
+			}
+
+			seek, logical, err := NewSeekableDecrypter(bytes.NewReader(sealed), key, int64(len(sealed)))
+			if err != nil {
+				t.Fatalf("NewSeekableDecrypter(cipher=%d,size=%d): %v", cipherID, size, err)
+			}
+			if logical != int64(size) {
+				t.Fatalf("logical size: got %d want %d", logical, size)
+			}
+			got, err = io.ReadAll(seek)
+			if err != nil {
+				t.Fatalf("ReadAll(seek): %v", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatalf("seekable mismatch (cipher=%d,size=%d)", cipherID, size)
+			}
+		}
+	}
+}
+
+func TestContainer_SeekRange(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	plain := make([]byte, 1000)
+	rand.Read(plain)
+	sealed := sealContainer(t, plain, key, CipherAESGCM, 64)
+
+	dec, _, err := NewSeekableDecrypter(bytes.NewReader(sealed), key, 0)
+	if err != nil {
+		t.Fatalf("NewSeekableDecrypter: %v", err)
+	}
+	if _, err := dec.Seek(130, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	got := make([]byte, 200)
+	if _, err := io.ReadFull(dec, got); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(got, plain[130:330]) {
+		t.Fatal("range mismatch")
+	}
+
+	if _, err := dec.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatalf("Seek(end): %v", err)
+	}
+	tail, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatalf("ReadAll(tail): %v", err)
+	}
+	if !bytes.Equal(tail, plain[990:]) {
+		t.Fatal("tail mismatch")
+	}
+}
+
+func TestContainer_RejectsTampering(t *testing.T) {
+	key := bytes.Repeat([]byte{0x02}, 32)
+	plain := make([]byte, 300)
+	rand.Read(plain)
+	sealed := sealContainer(t, plain, key, CipherAESGCM, 64)
+
+	readAll := func(blob, key []byte) error {
+		dec, err := NewDecryptReader(bytes.NewReader(blob), key)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(dec)
+		return err
+	}
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)/2] ^= 0x01
+	if err := readAll(flipped, key); err != ErrAuthFailed {
+		t.Fatalf("flipped byte: got %v want ErrAuthFailed", err)
+	}
+
+	// Truncating exactly on a chunk boundary drops the final chunk
+	truncated := sealed[:ContainerHeaderLen+2*(64+aeadTagSize)]
+	if err := readAll(truncated, key); err != ErrAuthFailed {
+		t.Fatalf("truncated: got %v want ErrAuthFailed", err)
+	}
+
+	wrongKey := bytes.Repeat([]byte{0x03}, 32)
+	if err := readAll(sealed, wrongKey); err != ErrAuthFailed {
+		t.Fatalf("wrong key: got %v want ErrAuthFailed", err)
+	}
+	if _, _, err := NewSeekableDecrypter(bytes.NewReader(sealed), wrongKey, 0); err != ErrAuthFailed {
+		t.Fatalf("seekable wrong key: got %v want ErrAuthFailed", err)
+	}
+}
+
+func TestContainer_LegacyCTRStillReadable(t *testing.T) {
+	key := bytes.Repeat([]byte{0x04}, 32)
+	plain := []byte("legacy ctr blob")
+
+	enc, err := NewAESCTRReader(bytes.NewReader(plain), key)
+	if err != nil {
+		t.Fatalf("NewAESCTRReader: %v", err)
+	}
+	sealed, err := io.ReadAll(enc)
+	if err != nil {
+		t.Fatalf("ReadAll(enc): %v", err)
+	}
+
+	dec, err := NewDecryptReader(bytes.NewReader(sealed), key)
+	if err != nil {
+		t.Fatalf("NewDecryptReader: %v", err)
+	}
+	got, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatalf("ReadAll(dec): %v", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("legacy mismatch: got %q", got)
+	}
+
+	seek, logical, err := NewSeekableDecrypter(bytes.NewReader(sealed), key, 0)
+	if err != nil {
+		t.Fatalf("NewSeekableDecrypter: %v", err)
+	}
+	if logical != int64(len(plain)) {
+		t.Fatalf("legacy logical size: got %d want %d", logical, len(plain))
+	}
+	got, err = io.ReadAll(seek)
+	if err != nil {
+		t.Fatalf("ReadAll(seek): %v", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("legacy seekable mismatch: got %q", got)
+	}
+}
+
+func TestContainer_MetadataEnvelope(t *testing.T) {
+	key := bytes.Repeat([]byte{0x05}, 32)
+	plain := make([]byte, 200)
+	rand.Read(plain)
+	meta := &FileMetadata{Name: "report.pdf", MimeType: "application/pdf", Size: int64(len(plain))}
+
+	enc, err := NewEncryptReaderWithMetadata(bytes.NewReader(plain), key, meta)
+	if err != nil {
+		t.Fatalf("NewEncryptReaderWithMetadata: %v", err)
+	}
+	sealed, err := io.ReadAll(enc)
+	if err != nil {
+		t.Fatalf("ReadAll(enc): %v", err)
+	}
+	if bytes.Contains(sealed, []byte("report.pdf")) {
+		t.Fatal("file name leaked into ciphertext")
+	}
+
+	got, err := ReadMetadata(bytes.NewReader(sealed), key)
+	if err != nil {
+		t.Fatalf("ReadMetadata: %v", err)
+	}
+	if got.Name != meta.Name || got.MimeType != meta.MimeType || got.Size != meta.Size {
+		t.Fatalf("metadata mismatch: %+v", got)
+	}
+
+	seek, logical, err := NewSeekableDecrypter(bytes.NewReader(sealed), key, 0)
+	if err != nil {
+		t.Fatalf("NewSeekableDecrypter: %v", err)
+	}
+	if logical != int64(len(plain)) {
+		t.Fatalf("logical size: got %d want %d", logical, len(plain))
+	}
+	if m := seek.(MetadataReader).Metadata(); m == nil || m.Name != meta.Name {
+		t.Fatalf("seekable metadata: %+v", m)
+	}
+	data, err := io.ReadAll(seek)
+	if err != nil {
+		t.Fatalf("ReadAll(seek): %v", err)
+	}
+	if !bytes.Equal(data, plain) {
+		t.Fatal("seekable mismatch")
+	}
+
+	// Clearing the metadata flag must break every chunk
+	stripped := append([]byte(nil), sealed...)
+	stripped[7] = 0
+	if _, err := ReadMetadata(bytes.NewReader(stripped), key); err != nil {
+		t.Fatalf("ReadMetadata(stripped): %v", err)
+	}
+	dec, err := NewDecryptReader(bytes.NewReader(stripped), key)
+	if err == nil {
+		_, err = io.ReadAll(dec)
+	}
+	if err != ErrAuthFailed {
+		t.Fatalf("stripped flag: got %v want ErrAuthFailed", err)
+	}
+}
@@ -3,14 +3,119 @@ package crypto
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/argon2"
 )
 
-// DeriveKey derives a 32-byte key from a password and salt using Argon2id
+// KDFParams are the Argon2id cost parameters used to derive a key
+type KDFParams struct {
+	Time    uint32 // Iterations
+	Memory  uint32 // KiB
+	Threads uint8
+}
+
+var (
+	// LegacyKDFParams is what DeriveKey always used; a bare hex salt implies these
+	LegacyKDFParams = KDFParams{Time: 1, Memory: 64 * 1024, Threads: 4}
+	// DefaultKDFParams is used for new salts and account upgrades
+	DefaultKDFParams = KDFParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+)
+
+// Upper bounds for parameters read from links and metadata, so a crafted salt
+// cannot make a preview or import allocate or spin much beyond
+// DefaultKDFParams
+const (
+	maxKDFTime    = 8
+	maxKDFMemory  = 256 * 1024 // 256 MiB
+	maxKDFThreads = 16
+)
+
+const kdfSaltPrefix = "argon2id:"
+
+// DeriveKey derives a 32-byte key from a password and salt using Argon2id with LegacyKDFParams
 func DeriveKey(password string, salt []byte) []byte {
-	// Params: time=1, memory=64MB, threads=4, keyLen=32
-	return argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
+	return LegacyKDFParams.DeriveKey(password, salt)
+}
+
+// DeriveKey derives a 32-byte key from a password and salt with these parameters
+func (p KDFParams) DeriveKey(password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, 32)
+}
+
+// Weaker reports whether p costs less than other in time or memory
+func (p KDFParams) Weaker(other KDFParams) bool {
+	return p.Time < other.Time || p.Memory < other.Memory
+}
+
+func (p KDFParams) validate() error {
+	if p.Time == 0 || p.Time > maxKDFTime {
+		return fmt.Errorf("invalid kdf time %d", p.Time)
+	}
+	if p.Memory < 8*uint32(p.Threads) || p.Memory > maxKDFMemory {
+		return fmt.Errorf("invalid kdf memory %d", p.Memory)
+	}
+	if p.Threads == 0 || p.Threads > maxKDFThreads {
+		return fmt.Errorf("invalid kdf threads %d", p.Threads)
+	}
+	return nil
+}
+
+// EncodeKDFSalt renders a salt with its parameters as
+// "argon2id:t=3,m=65536,p=4:<hex salt>". It is stored wherever a bare hex salt
+// used to be (File.EncryptionMeta, Account.Salt, the link "salt" field).
+func EncodeKDFSalt(salt []byte, p KDFParams) string {
+	return fmt.Sprintf("%st=%d,m=%d,p=%d:%s", kdfSaltPrefix, p.Time, p.Memory, p.Threads, hex.EncodeToString(salt))
+}
+
+// ParseKDFSalt decodes a value written by EncodeKDFSalt. A bare hex salt
+// decodes with LegacyKDFParams.
+func ParseKDFSalt(value string) ([]byte, KDFParams, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, kdfSaltPrefix) {
+		salt, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, KDFParams{}, fmt.Errorf("invalid salt: %w", err)
+		}
+		return salt, LegacyKDFParams, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, kdfSaltPrefix), ":", 2)
+	if len(parts) != 2 {
+		return nil, KDFParams{}, fmt.Errorf("invalid kdf salt")
+	}
+	var p KDFParams
+	if _, err := fmt.Sscanf(parts[0], "t=%d,m=%d,p=%d", &p.Time, &p.Memory, &p.Threads); err != nil {
+		return nil, KDFParams{}, fmt.Errorf("invalid kdf params: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, KDFParams{}, err
+	}
+	salt, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return nil, KDFParams{}, fmt.Errorf("invalid salt: %w", err)
+	}
+	return salt, p, nil
+}
+
+// NewKDFSalt generates a random 16-byte salt encoded with DefaultKDFParams
+func NewKDFSalt() (string, error) {
+	salt, err := GenerateSalt(16)
+	if err != nil {
+		return "", err
+	}
+	return EncodeKDFSalt(salt, DefaultKDFParams), nil
+}
+
+// DeriveKeyFromSalt derives a key using the parameters encoded in an
+// EncodeKDFSalt (or legacy hex) value
+func DeriveKeyFromSalt(password, encodedSalt string) ([]byte, error) {
+	salt, p, err := ParseKDFSalt(encodedSalt)
+	if err != nil {
+		return nil, err
+	}
+	return p.DeriveKey(password, salt), nil
 }
 
 // GenerateSalt generates a random salt of given length
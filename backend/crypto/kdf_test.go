@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestKDFSalt_RoundTrip(t *testing.T) {
+	encoded, err := NewKDFSalt()
+	if err != nil {
+		t.Fatalf("NewKDFSalt: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "argon2id:t=3,m=65536,p=4:") {
+		t.Fatalf("unexpected encoding %q", encoded)
+	}
+
+	salt, params, err := ParseKDFSalt(encoded)
+	if err != nil {
+		t.Fatalf("ParseKDFSalt: %v", err)
+	}
+	if params != DefaultKDFParams || len(salt) != 16 {
+		t.Fatalf("got params %+v salt %d bytes", params, len(salt))
+	}
+
+	key, err := DeriveKeyFromSalt("pw", encoded)
+	if err != nil {
+		t.Fatalf("DeriveKeyFromSalt: %v", err)
+	}
+	if !bytes.Equal(key, DefaultKDFParams.DeriveKey("pw", salt)) {
+		t.Fatal("derived key mismatch")
+	}
+}
+
+func TestKDFSalt_LegacyHex(t *testing.T) {
+	salt := bytes.Repeat([]byte{0x42}, 16)
+	key, err := DeriveKeyFromSalt("pw", hex.EncodeToString(salt))
+	if err != nil {
+		t.Fatalf("DeriveKeyFromSalt: %v", err)
+	}
+	if !bytes.Equal(key, DeriveKey("pw", salt)) {
+		t.Fatal("legacy hex salt must derive with the original parameters")
+	}
+	if !LegacyKDFParams.Weaker(DefaultKDFParams) {
+		t.Fatal("legacy params should be upgradable")
+	}
+}
+
+func TestKDFSalt_RejectsUnboundedParams(t *testing.T) {
+	for _, v := range []string{
+		"argon2id:t=0,m=65536,p=4:00",
+		"argon2id:t=3,m=99999999,p=4:00",
+		"argon2id:t=3,m=1048576,p=4:00",
+		"argon2id:t=16,m=65536,p=4:00",
+		"argon2id:t=3,m=65536,p=64:00",
+		"argon2id:t=3,m=65536,p=0:00",
+		"argon2id:t=3,m=65536:00",
+	} {
+		if _, _, err := ParseKDFSalt(v); err == nil {
+			t.Fatalf("expected error for %q", v)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// FileMetadata is the encrypted envelope stored inside a v2 container. It keeps
+// the original name, type and size out of the clear so links and CIDs do not
+// leak them.
+type FileMetadata struct {
+	Name       string    `json:"name"`
+	MimeType   string    `json:"mime_type,omitempty"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// MetadataReader is implemented by decryptors that found an envelope in the container
+type MetadataReader interface {
+	Metadata() *FileMetadata
+}
+
+const (
+	flagMetadata = 0x01
+
+	// The envelope uses the last nonce index, which no data chunk can reach
+	metadataNonceIndex = math.MaxUint64
+	maxMetadataLen     = 64 * 1024
+)
+
+func metadataAAD(header []byte) []byte {
+	return append(append([]byte(nil), header...), "mochi-meta"...)
+}
+
+// sealMetadata returns [4B length][sealed JSON envelope]
+func sealMetadata(aead cipher.AEAD, header []byte, meta *FileMetadata) ([]byte, error) {
+	plain, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	nonce := chunkNonce(aead, header[12:], metadataNonceIndex)
+	sealed := aead.Seal(nil, nonce, plain, metadataAAD(header))
+	if len(sealed) > maxMetadataLen {
+		return nil, fmt.Errorf("metadata too large")
+	}
+
+	out := make([]byte, 4, 4+len(sealed))
+	binary.BigEndian.PutUint32(out, uint32(len(sealed)))
+	return append(out, sealed...), nil
+}
+
+// readMetadata reads and opens the envelope following the header. It returns
+// the envelope and the number of bytes consumed from src.
+func readMetadata(src io.Reader, aead cipher.AEAD, h *containerHeader) (*FileMetadata, int64, error) {
+	lenBuf := make([]byte, 4)
+	if _, err := io.ReadFull(src, lenBuf); err != nil {
+		return nil, 0, ErrAuthFailed
+	}
+	sealedLen := binary.BigEndian.Uint32(lenBuf)
+	if sealedLen < aeadTagSize || sealedLen > maxMetadataLen {
+		return nil, 0, ErrAuthFailed
+	}
+	sealed := make([]byte, sealedLen)
+	if _, err := io.ReadFull(src, sealed); err != nil {
+		return nil, 0, ErrAuthFailed
+	}
+
+	nonce := chunkNonce(aead, h.noncePrefix, metadataNonceIndex)
+	plain, err := aead.Open(nil, nonce, sealed, metadataAAD(h.raw))
+	if err != nil {
+		return nil, 0, ErrAuthFailed
+	}
+	var meta FileMetadata
+	if err := json.Unmarshal(plain, &meta); err != nil {
+		return nil, 0, fmt.Errorf("invalid metadata envelope: %w", err)
+	}
+	return &meta, int64(4 + sealedLen), nil
+}
+
+// ReadMetadata decrypts only the metadata envelope at the start of an encrypted
+// blob. It returns (nil, nil) for legacy blobs and containers without one.
+func ReadMetadata(src io.Reader, key []byte) (*FileMetadata, error) {
+	head := make([]byte, ContainerHeaderLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if !IsContainerHeader(head[:n]) {
+		return nil, nil
+	}
+	h, err := parseContainerHeader(head[:n])
+	if err != nil {
+		return nil, err
+	}
+	if h.flags&flagMetadata == 0 {
+		return nil, nil
+	}
+	aead, err := newContainerAEAD(h.cipherID, key)
+	if err != nil {
+		return nil, err
+	}
+	meta, _, err := readMetadata(src, aead, h)
+	return meta, err
+}
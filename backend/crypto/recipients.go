@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RecipientKey is the session key of a private file sealed to one recipient
+type RecipientKey struct {
+	PubKey       string `json:"pk"` // Ed25519 Hex (empty for legacy single-recipient meta)
+	EncryptedKey string `json:"ek"` // Base64 sealed box
+}
+
+// SealSessionKeyFor wraps the session key once per recipient Ed25519 public key (hex)
+func SealSessionKeyFor(sessionKey []byte, pubKeysHex []string) ([]RecipientKey, error) {
+	recipients := make([]RecipientKey, 0, len(pubKeysHex))
+	for _, pubHex := range pubKeysHex {
+		edPub, err := hex.DecodeString(pubHex)
+		if err != nil || len(edPub) != 32 {
+			return nil, fmt.Errorf("invalid public key %q", pubHex)
+		}
+		curvePub, err := Ed25519PublicKeyToCurve25519(edPub)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert key: %w", err)
+		}
+		encKey, err := EncryptSessionKey(curvePub, sessionKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt session key: %w", err)
+		}
+		recipients = append(recipients, RecipientKey{
+			PubKey:       strings.ToLower(pubHex),
+			EncryptedKey: base64.StdEncoding.EncodeToString(encKey),
+		})
+	}
+	return recipients, nil
+}
+
+// EncodeRecipientKeys serializes the recipient list for File.EncryptionMeta
+func EncodeRecipientKeys(recipients []RecipientKey) (string, error) {
+	data, err := json.Marshal(recipients)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DecodeRecipientKeys parses private-mode EncryptionMeta. It accepts the JSON
+// recipient list as well as the legacy single base64 sealed key.
+func DecodeRecipientKeys(meta string) ([]RecipientKey, error) {
+	meta = strings.TrimSpace(meta)
+	if meta == "" {
+		return nil, fmt.Errorf("empty encryption metadata")
+	}
+	if strings.HasPrefix(meta, "[") {
+		var recipients []RecipientKey
+		if err := json.Unmarshal([]byte(meta), &recipients); err != nil {
+			return nil, fmt.Errorf("invalid recipient list: %w", err)
+		}
+		return recipients, nil
+	}
+	return []RecipientKey{{EncryptedKey: meta}}, nil
+}
+
+// ParsePubKeyList splits a comma/whitespace separated list of hex public keys,
+// dropping blanks and duplicates
+func ParsePubKeyList(values ...string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, v := range values {
+		for _, k := range strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\t'
+		}) {
+			k = strings.ToLower(strings.TrimSpace(k))
+			if k == "" || seen[k] {
+				continue
+			}
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestRecipientKeys_EachRecipientCanOpen(t *testing.T) {
+	alice, err := NewWallet("")
+	if err != nil {
+		t.Fatalf("NewWallet: %v", err)
+	}
+	bob, err := NewWallet("")
+	if err != nil {
+		t.Fatalf("NewWallet: %v", err)
+	}
+
+	sessionKey := bytes.Repeat([]byte{0x09}, 32)
+	keys := ParsePubKeyList(hex.EncodeToString(alice.PublicKey) + ", " + hex.EncodeToString(bob.PublicKey))
+	recipients, err := SealSessionKeyFor(sessionKey, keys)
+	if err != nil {
+		t.Fatalf("SealSessionKeyFor: %v", err)
+	}
+
+	meta, err := EncodeRecipientKeys(recipients)
+	if err != nil {
+		t.Fatalf("EncodeRecipientKeys: %v", err)
+	}
+	decoded, err := DecodeRecipientKeys(meta)
+	if err != nil {
+		t.Fatalf("DecodeRecipientKeys: %v", err)
+	}
+	if len(decoded) != 2 {
+		t.Fatalf("recipients: got %d want 2", len(decoded))
+	}
+
+	for i, w := range []*Wallet{alice, bob} {
+		if decoded[i].PubKey != hex.EncodeToString(w.PublicKey) {
+			t.Fatalf("recipient %d: unexpected key %s", i, decoded[i].PubKey)
+		}
+		enc, _ := base64.StdEncoding.DecodeString(decoded[i].EncryptedKey)
+		got, err := w.DecryptSessionKey(enc)
+		if err != nil {
+			t.Fatalf("recipient %d: DecryptSessionKey: %v", i, err)
+		}
+		if !bytes.Equal(got, sessionKey) {
+			t.Fatalf("recipient %d: session key mismatch", i)
+		}
+	}
+}
+
+func TestDecodeRecipientKeys_Legacy(t *testing.T) {
+	decoded, err := DecodeRecipientKeys("c2VhbGVk")
+	if err != nil {
+		t.Fatalf("DecodeRecipientKeys: %v", err)
+	}
+	if len(decoded) != 1 || decoded[0].PubKey != "" || decoded[0].EncryptedKey != "c2VhbGVk" {
+		t.Fatalf("unexpected legacy decode: %+v", decoded)
+	}
+}
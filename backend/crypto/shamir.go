@@ -0,0 +1,247 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Mnemonic backup shares split the BIP39 entropy with Shamir's secret sharing
+// over GF(256). Each share is encoded as BIP39 words (11 bits per word):
+//
+//	[1B version][1B threshold][1B index][2B set id][entropy-sized y][4B sha256 checksum]
+//
+// The set id keeps shares of different splits from being combined by accident.
+
+const (
+	shareVersion     = 1
+	shareHeaderLen   = 5
+	shareChecksumLen = 4
+	maxShares        = 255
+)
+
+// SplitMnemonic splits the mnemonic's entropy into n word-encoded shares, any
+// k of which recover it with CombineMnemonicShares
+func SplitMnemonic(mnemonic string, n, k int) ([]string, error) {
+	if k < 2 || n < k || n > maxShares {
+		return nil, fmt.Errorf("invalid share parameters: need 2 <= threshold <= shares <= %d", maxShares)
+	}
+	entropy, err := bip39.EntropyFromMnemonic(mnemonic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic")
+	}
+
+	var setID [2]byte
+	if _, err := rand.Read(setID[:]); err != nil {
+		return nil, err
+	}
+
+	ys, err := shamirSplit(entropy, n, k)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]string, n)
+	for i, y := range ys {
+		raw := make([]byte, 0, shareHeaderLen+len(y)+shareChecksumLen)
+		raw = append(raw, shareVersion, byte(k), byte(i+1), setID[0], setID[1])
+		raw = append(raw, y...)
+		sum := sha256.Sum256(raw)
+		raw = append(raw, sum[:shareChecksumLen]...)
+		shares[i] = bytesToWords(raw)
+	}
+	return shares, nil
+}
+
+// CombineMnemonicShares rebuilds the mnemonic from at least threshold shares
+func CombineMnemonicShares(shares []string) (string, error) {
+	if len(shares) == 0 {
+		return "", fmt.Errorf("no shares provided")
+	}
+
+	var threshold byte
+	var setID uint16
+	xs := make([]byte, 0, len(shares))
+	ys := make([][]byte, 0, len(shares))
+	seen := make(map[byte]bool)
+
+	for i, s := range shares {
+		raw, err := wordsToBytes(s)
+		if err != nil {
+			return "", fmt.Errorf("share %d: %w", i+1, err)
+		}
+		if len(raw) < shareHeaderLen+16+shareChecksumLen {
+			return "", fmt.Errorf("share %d: too short", i+1)
+		}
+		// BIP39 entropy is a multiple of 4 bytes; the last word can carry a
+		// whole padding byte, which must be zero
+		if extra := (len(raw) - shareHeaderLen - shareChecksumLen) % 4; extra != 0 {
+			for _, b := range raw[len(raw)-extra:] {
+				if b != 0 {
+					return "", fmt.Errorf("share %d: invalid padding", i+1)
+				}
+			}
+			raw = raw[:len(raw)-extra]
+		}
+		body, sum := raw[:len(raw)-shareChecksumLen], raw[len(raw)-shareChecksumLen:]
+		want := sha256.Sum256(body)
+		if subtle.ConstantTimeCompare(sum, want[:shareChecksumLen]) != 1 {
+			return "", fmt.Errorf("share %d: checksum mismatch", i+1)
+		}
+		if body[0] != shareVersion {
+			return "", fmt.Errorf("share %d: unsupported version %d", i+1, body[0])
+		}
+
+		k, x, id := body[1], body[2], binary.BigEndian.Uint16(body[3:5])
+		if i == 0 {
+			threshold, setID = k, id
+		} else if k != threshold || id != setID || len(body)-shareHeaderLen != len(ys[0]) {
+			return "", fmt.Errorf("share %d belongs to a different backup", i+1)
+		}
+		if x == 0 {
+			return "", fmt.Errorf("share %d: invalid index", i+1)
+		}
+		if seen[x] {
+			continue
+		}
+		seen[x] = true
+		xs = append(xs, x)
+		ys = append(ys, body[shareHeaderLen:])
+	}
+
+	if len(xs) < int(threshold) {
+		return "", fmt.Errorf("need %d shares, got %d", threshold, len(xs))
+	}
+
+	entropy := shamirCombine(xs[:threshold], ys[:threshold])
+	return bip39.NewMnemonic(entropy)
+}
+
+// shamirSplit returns n share values (x = 1..n) for secret with threshold k
+func shamirSplit(secret []byte, n, k int) ([][]byte, error) {
+	ys := make([][]byte, n)
+	for i := range ys {
+		ys[i] = make([]byte, len(secret))
+	}
+
+	coeffs := make([]byte, k)
+	for b, s := range secret {
+		// Random polynomial of degree k-1 with the secret byte as constant term
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		coeffs[0] = s
+		for i := 0; i < n; i++ {
+			ys[i][b] = gfEval(coeffs, byte(i+1))
+		}
+	}
+	return ys, nil
+}
+
+// shamirCombine interpolates the shares at x = 0
+func shamirCombine(xs []byte, ys [][]byte) []byte {
+	secret := make([]byte, len(ys[0]))
+	for i, xi := range xs {
+		// Lagrange basis polynomial for xi evaluated at 0
+		basis := byte(1)
+		for j, xj := range xs {
+			if i == j {
+				continue
+			}
+			basis = gfMul(basis, gfDiv(xj, xj^xi))
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(ys[i][b], basis)
+		}
+	}
+	return secret
+}
+
+// gfEval evaluates the polynomial at x using Horner's method
+func gfEval(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(2^8) with the AES polynomial x^8+x^4+x^3+x+1
+func gfMul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func gfInv(a byte) byte {
+	// a^254 == a^-1 in GF(2^8)
+	result := byte(1)
+	for i := 0; i < 254; i++ {
+		result = gfMul(result, a)
+	}
+	return result
+}
+
+func gfDiv(a, b byte) byte {
+	return gfMul(a, gfInv(b))
+}
+
+// bytesToWords packs data into 11-bit BIP39 words, zero padding the last one
+func bytesToWords(data []byte) string {
+	list := bip39.GetWordList()
+	words := make([]string, 0, (len(data)*8+10)/11)
+	var acc uint32
+	var bits uint
+	for _, b := range data {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 11 {
+			bits -= 11
+			words = append(words, list[(acc>>bits)&0x7ff])
+		}
+	}
+	if bits > 0 {
+		words = append(words, list[(acc<<(11-bits))&0x7ff])
+	}
+	return strings.Join(words, " ")
+}
+
+// wordsToBytes reverses bytesToWords
+func wordsToBytes(s string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(s))
+	out := make([]byte, 0, len(words)*11/8)
+	var acc uint32
+	var bits uint
+	for _, w := range words {
+		idx, ok := bip39.GetWordIndex(w)
+		if !ok {
+			return nil, fmt.Errorf("unknown word %q", w)
+		}
+		acc = acc<<11 | uint32(idx)
+		bits += 11
+		for bits >= 8 {
+			bits -= 8
+			out = append(out, byte(acc>>bits))
+		}
+	}
+	// Leftover bits are padding and must be zero
+	if bits > 0 && acc&(1<<bits-1) != 0 {
+		return nil, fmt.Errorf("invalid share padding")
+	}
+	return out, nil
+}
@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+func TestMnemonicShares_AnyThresholdSubset(t *testing.T) {
+	for _, bits := range []int{128, 256} {
+		entropy, _ := bip39.NewEntropy(bits)
+		mnemonic, _ := bip39.NewMnemonic(entropy)
+
+		shares, err := SplitMnemonic(mnemonic, 5, 3)
+		if err != nil {
+			t.Fatalf("SplitMnemonic: %v", err)
+		}
+		if len(shares) != 5 {
+			t.Fatalf("got %d shares", len(shares))
+		}
+
+		for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+			var picked []string
+			for _, i := range subset {
+				picked = append(picked, shares[i])
+			}
+			got, err := CombineMnemonicShares(picked)
+			if err != nil {
+				t.Fatalf("%d bits, subset %v: %v", bits, subset, err)
+			}
+			if got != mnemonic {
+				t.Fatalf("%d bits, subset %v: mnemonic mismatch", bits, subset)
+			}
+		}
+
+		if _, err := CombineMnemonicShares(shares[:2]); err == nil {
+			t.Fatalf("%d bits: expected error below threshold", bits)
+		}
+	}
+}
+
+func TestMnemonicShares_Checksum(t *testing.T) {
+	w, _ := NewWallet("")
+	shares, err := SplitMnemonic(w.Mnemonic, 3, 2)
+	if err != nil {
+		t.Fatalf("SplitMnemonic: %v", err)
+	}
+
+	// Flip one bit of the share value; the words stay valid
+	raw, _ := wordsToBytes(shares[0])
+	raw[6] ^= 0x01
+	tampered := bytesToWords(raw)
+	if tampered == shares[0] {
+		t.Fatal("tampering had no effect")
+	}
+	if _, err := CombineMnemonicShares([]string{tampered, shares[1]}); err == nil {
+		t.Fatal("expected checksum error")
+	}
+
+	other, _ := SplitMnemonic(w.Mnemonic, 3, 2)
+	if _, err := CombineMnemonicShares([]string{shares[0], other[1]}); err == nil {
+		t.Fatal("expected error mixing shares of different backups")
+	}
+}
@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+)
+
+// SLIP-0010 key derivation for Ed25519. Only hardened children exist for this
+// curve, so every path element is hardened.
+
+const (
+	HardenedOffset uint32 = 0x80000000
+
+	// IdentityCoinType is the BIP44 coin type used for MochiBox identities
+	IdentityCoinType uint32 = 5381
+
+	// FeedAccount is the branch under the coin type that holds IPNS feed keys.
+	// It is the last hardened index, which identity indexes never reach.
+	FeedAccount uint32 = HardenedOffset - 1
+)
+
+// DeriveSLIP10Ed25519 derives the Ed25519 key at path (indexes without the
+// hardened offset) from a BIP39 seed
+func DeriveSLIP10Ed25519(seed []byte, path []uint32) (ed25519.PrivateKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("invalid seed length %d", len(seed))
+	}
+
+	mac := hmac.New(sha512.New, []byte("ed25519 seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chainCode := sum[:32], sum[32:]
+
+	for _, index := range path {
+		if index >= HardenedOffset {
+			return nil, fmt.Errorf("path index %d out of range", index)
+		}
+		data := make([]byte, 0, 37)
+		data = append(data, 0x00)
+		data = append(data, key...)
+		data = binary.BigEndian.AppendUint32(data, index|HardenedOffset)
+
+		mac = hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum = mac.Sum(nil)
+		key, chainCode = sum[:32], sum[32:]
+	}
+
+	return ed25519.NewKeyFromSeed(key), nil
+}
+
+// IdentityPath returns m/44'/5381'/index'
+func IdentityPath(index uint32) []uint32 {
+	return []uint32{44, IdentityCoinType, index}
+}
+
+// FeedPath returns m/44'/5381'/2147483647'/slot'. Slot 0 belongs to the root
+// identity and slot index+1 to derived identity index.
+func FeedPath(slot uint32) []uint32 {
+	return []uint32{44, IdentityCoinType, FeedAccount, slot}
+}
+
+// DeriveIdentityKey derives the keypair of identity index from the wallet seed
+func (w *Wallet) DeriveIdentityKey(index uint32) (ed25519.PrivateKey, error) {
+	return DeriveSLIP10Ed25519(w.Seed, IdentityPath(index))
+}
+
+// DeriveFeedKey derives the IPNS key of the feed in slot from the wallet seed
+func (w *Wallet) DeriveFeedKey(slot uint32) (ed25519.PrivateKey, error) {
+	return DeriveSLIP10Ed25519(w.Seed, FeedPath(slot))
+}
+
+// RootKey is the original identity key taken directly from the seed
+func (w *Wallet) RootKey() ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(w.Seed[:32])
+}
+
+// UseKey makes priv the wallet's active signing and decryption key
+func (w *Wallet) UseKey(priv ed25519.PrivateKey) {
+	w.PrivateKey = priv
+	w.PublicKey = priv.Public().(ed25519.PublicKey)
+}
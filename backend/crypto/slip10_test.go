@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// SLIP-0010 test vector 1 for ed25519
+func TestDeriveSLIP10Ed25519_Vector(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	cases := []struct {
+		path []uint32
+		priv string
+	}{
+		{nil, "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7"},
+		{[]uint32{0}, "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3"},
+	}
+	for _, tc := range cases {
+		key, err := DeriveSLIP10Ed25519(seed, tc.path)
+		if err != nil {
+			t.Fatalf("path %v: %v", tc.path, err)
+		}
+		if got := hex.EncodeToString(key.Seed()); got != tc.priv {
+			t.Fatalf("path %v: got %s want %s", tc.path, got, tc.priv)
+		}
+	}
+}
+
+func TestWallet_IdentitiesAreIndependent(t *testing.T) {
+	w, err := NewWallet("")
+	if err != nil {
+		t.Fatalf("NewWallet: %v", err)
+	}
+	work, _ := w.DeriveIdentityKey(0)
+	personal, _ := w.DeriveIdentityKey(1)
+	again, _ := w.DeriveIdentityKey(0)
+
+	if !bytes.Equal(work, again) {
+		t.Fatal("derivation must be deterministic")
+	}
+	if bytes.Equal(work, personal) || bytes.Equal(work, w.RootKey()) {
+		t.Fatal("identities must have distinct keys")
+	}
+	if !bytes.Equal(w.RootKey(), w.PrivateKey) {
+		t.Fatal("root key must match the original wallet key")
+	}
+}
+
+func TestWallet_FeedKeysAreSeparate(t *testing.T) {
+	w, err := NewWallet("")
+	if err != nil {
+		t.Fatalf("NewWallet: %v", err)
+	}
+	feed, _ := w.DeriveFeedKey(1)
+	again, _ := w.DeriveFeedKey(1)
+	identity, _ := w.DeriveIdentityKey(0)
+	rootFeed, _ := w.DeriveFeedKey(0)
+
+	if !bytes.Equal(feed, again) {
+		t.Fatal("feed key derivation must be deterministic")
+	}
+	if bytes.Equal(feed, identity) || bytes.Equal(feed, rootFeed) || bytes.Equal(rootFeed, w.RootKey()) {
+		t.Fatal("feed keys must differ from identity keys and from each other")
+	}
+}
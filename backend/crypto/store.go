@@ -5,15 +5,16 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
-// AppSecret should be hidden or constructed at runtime in a real app
-// We use a fixed key for local obfuscation to allow "Remember Me"
-// This is security-by-obscurity against remote attackers, but valid for local convenience
+// appSecret protected auth.lock files before per-install device keys. It is
+// only used to read and migrate those files.
 var appSecret = []byte{
     0x4d, 0x6f, 0x63, 0x68, 0x69, 0x42, 0x6f, 0x78, // MochiBox
     0x5f, 0x53, 0x65, 0x63, 0x75, 0x72, 0x65, 0x5f, // _Secure_
@@ -21,20 +22,75 @@ var appSecret = []byte{
     0x21, 0x40, 0x23, 0x24, 0x25, 0x5e, 0x26, 0x2a, // !@#$%^&*
 }
 
+// ErrAuthLockExpired is returned by LoadAuthLock once the lock is past its expiry
+var ErrAuthLockExpired = errors.New("auth lock expired")
+
+const (
+    authLockVersion = 2
+    deviceKeyFile   = "device.key"
+)
+
 type AuthLock struct {
-    Salt         []byte `json:"salt"`
-    EncryptedKey []byte `json:"encrypted_key"` // Encrypted Master Password (or derivative)
-    Nonce        []byte `json:"nonce"`
+    Version      int       `json:"version,omitempty"` // 0: legacy appSecret + raw password
+    Salt         []byte    `json:"salt,omitempty"`
+    EncryptedKey []byte    `json:"encrypted_key"` // Encrypted unlock token (legacy: master password)
+    Nonce        []byte    `json:"nonce"`
+    ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+// UnlockSecret is the content of an auth lock file
+type UnlockSecret struct {
+    Token []byte // Derived unlock token
+    // LegacyPassword is set for lock files written before device keys; the
+    // caller should unlock with it and save a token in its place
+    LegacyPassword []byte
+    ExpiresAt      time.Time
+}
+
+// loadOrCreateDeviceKey returns the per-install key protecting auth.lock,
+// generating it on first use. It lives outside the lock file so copying
+// auth.lock alone is not enough to recover the token.
+func loadOrCreateDeviceKey(dir string) ([]byte, error) {
+    path := filepath.Join(dir, deviceKeyFile)
+    if key, err := os.ReadFile(path); err == nil {
+        if len(key) != 32 {
+            return nil, fmt.Errorf("invalid device key")
+        }
+        return key, nil
+    } else if !os.IsNotExist(err) {
+        return nil, err
+    }
+
+    key := make([]byte, 32)
+    if _, err := io.ReadFull(rand.Reader, key); err != nil {
+        return nil, err
+    }
+    if err := os.WriteFile(path, key, 0600); err != nil {
+        return nil, err
+    }
+    return key, nil
 }
 
-// SaveAuthLock saves the master password (or key) to a lock file
-func SaveAuthLock(data []byte, dir string) error {
-    block, err := aes.NewCipher(appSecret)
+func authLockAAD(expiresAt time.Time) []byte {
+    return []byte(fmt.Sprintf("mochi-auth-lock:%d:%d", authLockVersion, expiresAt.Unix()))
+}
+
+func newAuthLockGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
     if err != nil {
-        return err
+        return nil, err
     }
+    return cipher.NewGCM(block)
+}
 
-    gcm, err := cipher.NewGCM(block)
+// SaveAuthLock saves an unlock token to the lock file, encrypted with the
+// device key. The lock is refused by LoadAuthLock after ttl.
+func SaveAuthLock(token []byte, dir string, ttl time.Duration) error {
+    deviceKey, err := loadOrCreateDeviceKey(dir)
+    if err != nil {
+        return err
+    }
+    gcm, err := newAuthLockGCM(deviceKey)
     if err != nil {
         return err
     }
@@ -44,12 +100,15 @@ func SaveAuthLock(data []byte, dir string) error {
         return err
     }
 
-    // Encrypt
-    encrypted := gcm.Seal(nil, nonce, data, nil)
+    // Expiry is bound into the AAD so it cannot be extended by editing the file
+    expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+    encrypted := gcm.Seal(nil, nonce, token, authLockAAD(expiresAt))
 
     lock := AuthLock{
+        Version:      authLockVersion,
         EncryptedKey: encrypted,
         Nonce:        nonce,
+        ExpiresAt:    expiresAt,
     }
 
     bytes, err := json.Marshal(lock)
@@ -61,8 +120,9 @@ func SaveAuthLock(data []byte, dir string) error {
     return os.WriteFile(path, bytes, 0600)
 }
 
-// LoadAuthLock loads and decrypts the master password from the lock file
-func LoadAuthLock(dir string) ([]byte, error) {
+// LoadAuthLock loads and decrypts the unlock token from the lock file. Expired
+// locks are removed and reported as ErrAuthLockExpired.
+func LoadAuthLock(dir string) (*UnlockSecret, error) {
     path := filepath.Join(dir, "auth.lock")
     bytes, err := os.ReadFile(path)
     if err != nil {
@@ -74,12 +134,38 @@ func LoadAuthLock(dir string) ([]byte, error) {
         return nil, err
     }
 
-    block, err := aes.NewCipher(appSecret)
+    if lock.Version == 0 {
+        return loadLegacyAuthLock(&lock)
+    }
+    if lock.Version != authLockVersion {
+        return nil, fmt.Errorf("unsupported auth lock version %d", lock.Version)
+    }
+
+    if !time.Now().Before(lock.ExpiresAt) {
+        os.Remove(path)
+        return nil, ErrAuthLockExpired
+    }
+
+    deviceKey, err := os.ReadFile(filepath.Join(dir, deviceKeyFile))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read device key: %w", err)
+    }
+    gcm, err := newAuthLockGCM(deviceKey)
     if err != nil {
         return nil, err
     }
 
-    gcm, err := cipher.NewGCM(block)
+    plaintext, err := gcm.Open(nil, lock.Nonce, lock.EncryptedKey, authLockAAD(lock.ExpiresAt.UTC()))
+    if err != nil {
+        return nil, fmt.Errorf("failed to decrypt auth lock")
+    }
+
+    return &UnlockSecret{Token: plaintext, ExpiresAt: lock.ExpiresAt}, nil
+}
+
+// loadLegacyAuthLock opens a lock written with the compiled-in appSecret
+func loadLegacyAuthLock(lock *AuthLock) (*UnlockSecret, error) {
+    gcm, err := newAuthLockGCM(appSecret)
     if err != nil {
         return nil, err
     }
@@ -89,7 +175,7 @@ func LoadAuthLock(dir string) ([]byte, error) {
         return nil, fmt.Errorf("failed to decrypt auth lock")
     }
 
-    return plaintext, nil
+    return &UnlockSecret{LegacyPassword: plaintext}, nil
 }
 
 // ClearAuthLock removes the lock file
@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthLock_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	token := bytes.Repeat([]byte{0x07}, 32)
+	if err := SaveAuthLock(token, dir, time.Hour); err != nil {
+		t.Fatalf("SaveAuthLock: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, deviceKeyFile))
+	if err != nil {
+		t.Fatalf("device key: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		t.Fatalf("device key permissions too open: %o", perm)
+	}
+
+	raw, _ := os.ReadFile(filepath.Join(dir, "auth.lock"))
+	if bytes.Contains(raw, token) {
+		t.Fatal("token stored in the clear")
+	}
+
+	secret, err := LoadAuthLock(dir)
+	if err != nil {
+		t.Fatalf("LoadAuthLock: %v", err)
+	}
+	if !bytes.Equal(secret.Token, token) || secret.LegacyPassword != nil {
+		t.Fatalf("unexpected secret %+v", secret)
+	}
+}
+
+func TestAuthLock_Expired(t *testing.T) {
+	dir := t.TempDir()
+	if err := SaveAuthLock([]byte("token"), dir, -time.Minute); err != nil {
+		t.Fatalf("SaveAuthLock: %v", err)
+	}
+	if _, err := LoadAuthLock(dir); !errors.Is(err, ErrAuthLockExpired) {
+		t.Fatalf("expected ErrAuthLockExpired, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "auth.lock")); !os.IsNotExist(err) {
+		t.Fatal("expired lock was not removed")
+	}
+}
+
+func TestAuthLock_ExtendedExpiryRejected(t *testing.T) {
+	dir := t.TempDir()
+	if err := SaveAuthLock([]byte("token"), dir, time.Hour); err != nil {
+		t.Fatalf("SaveAuthLock: %v", err)
+	}
+
+	path := filepath.Join(dir, "auth.lock")
+	raw, _ := os.ReadFile(path)
+	var lock AuthLock
+	json.Unmarshal(raw, &lock)
+	lock.ExpiresAt = lock.ExpiresAt.Add(365 * 24 * time.Hour)
+	raw, _ = json.Marshal(lock)
+	os.WriteFile(path, raw, 0600)
+
+	if _, err := LoadAuthLock(dir); err == nil {
+		t.Fatal("expected edited expiry to fail")
+	}
+}
+
+func TestAuthLock_LegacyFormat(t *testing.T) {
+	dir := t.TempDir()
+	gcm, err := newAuthLockGCM(appSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	raw, _ := json.Marshal(AuthLock{
+		EncryptedKey: gcm.Seal(nil, nonce, []byte("hunter2"), nil),
+		Nonce:        nonce,
+	})
+	os.WriteFile(filepath.Join(dir, "auth.lock"), raw, 0600)
+
+	secret, err := LoadAuthLock(dir)
+	if err != nil {
+		t.Fatalf("LoadAuthLock: %v", err)
+	}
+	if string(secret.LegacyPassword) != "hunter2" || secret.Token != nil {
+		t.Fatalf("unexpected legacy secret %+v", secret)
+	}
+}
@@ -15,23 +15,24 @@ type Wallet struct {
 	PublicKey  ed25519.PublicKey
 }
 
-// NewWallet creates a new random wallet
-func NewWallet() (*Wallet, error) {
+// NewWallet creates a new random wallet protected by a BIP39 passphrase ("" for none)
+func NewWallet(passphrase string) (*Wallet, error) {
 	entropy, err := bip39.NewEntropy(256) // 24 words for high security
 	if err != nil {
 		return nil, err
 	}
 	mnemonic, _ := bip39.NewMnemonic(entropy)
 
-	return RecoverWallet(mnemonic)
+	return RecoverWallet(mnemonic, passphrase)
 }
 
-// RecoverWallet recovers a wallet from mnemonic
-func RecoverWallet(mnemonic string) (*Wallet, error) {
+// RecoverWallet recovers a wallet from mnemonic and the BIP39 passphrase
+// ("25th word", "" for none). A different passphrase yields a different wallet.
+func RecoverWallet(mnemonic, passphrase string) (*Wallet, error) {
 	if !bip39.IsMnemonicValid(mnemonic) {
 		return nil, fmt.Errorf("invalid mnemonic")
 	}
-	seed := bip39.NewSeed(mnemonic, "") // No passphrase for BIP39 seed
+	seed := bip39.NewSeed(mnemonic, passphrase)
 
 	// Derive Ed25519 Key
 	// BIP-39 seed is 64 bytes. Ed25519 NewKeyFromSeed requires 32 bytes.
@@ -0,0 +1,31 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRecoverWallet_Passphrase(t *testing.T) {
+	w, err := NewWallet("")
+	if err != nil {
+		t.Fatalf("NewWallet: %v", err)
+	}
+
+	same, err := RecoverWallet(w.Mnemonic, "")
+	if err != nil {
+		t.Fatalf("RecoverWallet: %v", err)
+	}
+	if !bytes.Equal(same.PublicKey, w.PublicKey) {
+		t.Fatal("empty passphrase must match the default wallet")
+	}
+
+	a, _ := RecoverWallet(w.Mnemonic, "correct horse")
+	b, _ := RecoverWallet(w.Mnemonic, "correct horse")
+	c, _ := RecoverWallet(w.Mnemonic, "wrong horse")
+	if !bytes.Equal(a.PublicKey, b.PublicKey) {
+		t.Fatal("same passphrase must recover the same wallet")
+	}
+	if bytes.Equal(a.PublicKey, w.PublicKey) || bytes.Equal(a.PublicKey, c.PublicKey) {
+		t.Fatal("passphrase must change the derived wallet")
+	}
+}
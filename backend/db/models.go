@@ -8,39 +8,217 @@ import (
 )
 
 type File struct {
-	ID             uint           `gorm:"primaryKey" json:"id"`
-	CID            string         `gorm:"column:cid;index" json:"cid"`
-	Name           string         `json:"name"`
-	Size           int64          `json:"size"`
-	MimeType       string         `json:"mime_type"`
-	EncryptionType  string         `json:"encryption_type"` // public, password, private
-	EncryptionMeta  string         `json:"encryption_meta"` // salt (hex) or encrypted_key (base64)
-	SavedPassword   string         `json:"saved_password"`  // Encrypted password (by Account Public Key)
-	RecipientPubKey string         `json:"recipient_pub_key"` // Receiver Public Key (Hex)
-	IsFolder        bool           `json:"is_folder"`         // Is directory (Public) or Zip (Encrypted)
-	CreatedAt       time.Time      `json:"created_at"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	CID             string         `gorm:"column:cid;index" json:"cid"`
+	Name            string         `gorm:"index:,collate:NOCASE" json:"name"`
+	Size            int64          `gorm:"index" json:"size"`
+	MimeType        string         `gorm:"index:,collate:NOCASE" json:"mime_type"`
+	EncryptionType  string         `gorm:"index" json:"encryption_type"` // public, password, private
+	EncryptionMeta  string         `json:"encryption_meta"`              // KDF salt (legacy: bare hex) or recipient key list (JSON [{pk,ek}], legacy: encrypted_key base64)
+	SavedPassword   string         `json:"saved_password"`               // Encrypted password (by Account Public Key)
+	RecipientPubKey string         `json:"recipient_pub_key"`            // Receiver Public Keys (Hex, comma separated)
+	IsFolder        bool           `json:"is_folder"`                    // Is directory (Public) or Zip (Encrypted)
+	SealedMeta      bool           `json:"sealed_meta"`                  // Name/type/size also sealed inside the ciphertext
+	FolderID        *uint          `gorm:"index" json:"folder_id"`       // Virtual folder in My Files, nil = top level
+	Note            string         `json:"note"`                         // User note, searchable
+	Tags            []string       `gorm:"-" json:"tags"`
+	CreatedAt       time.Time      `gorm:"index" json:"created_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at"` // Set while in the trash; the pin is kept until purged
+}
+
+// Holders of a pin
+const (
+	PinFile      = "file"       // File row in My Files, including the trash; ID is the file ID
+	PinBundle    = "bundle"     // Bundle manifest we created; ID is the manifest CID
+	PinShortLink = "short_link" // Signed object behind a short link; ID is the object CID
+	PinFeed      = "feed"       // Latest published feed; ID is the owner public key
+)
+
+// PinRef records that a holder needs a CID pinned. A CID is unpinned only
+// when its last reference goes away.
+type PinRef struct {
+	CID        string    `gorm:"column:cid;primaryKey" json:"cid"`
+	HolderType string    `gorm:"primaryKey" json:"holder_type"`
+	HolderID   string    `gorm:"primaryKey" json:"holder_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Kinds of items that carry tags and show up in search
+const (
+	ItemFile   = "file"   // File in My Files
+	ItemShared = "shared" // SharedFile in Shared History
+)
+
+// Tag is a user-defined label
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex" json:"name"` // Lower case
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ItemTag joins tags to files and shared history entries
+type ItemTag struct {
+	TagID    uint   `gorm:"primaryKey;autoIncrement:false" json:"tag_id"`
+	ItemType string `gorm:"primaryKey;index:idx_item_tags_item" json:"item_type"` // ItemFile or ItemShared
+	ItemID   uint   `gorm:"primaryKey;autoIncrement:false;index:idx_item_tags_item" json:"item_id"`
+}
+
+// Folder is a virtual folder in My Files. It only organizes the library;
+// an uploaded directory is a single File with IsFolder set.
+type Folder struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `json:"name"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"` // nil = top level
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type SharedFile struct {
-	ID             uint      `gorm:"primaryKey" json:"id"`
-	CID            string    `gorm:"column:cid" json:"cid"`
-	Name           string    `json:"name"`
-	Size           int64     `json:"size"`
-	MimeType       string    `json:"mime_type"`
-	EncryptionType string    `json:"encryption_type"`
-	EncryptionMeta string    `json:"encryption_meta"`
-	OriginalLink   string    `json:"original_link"` // Store the full Mochi Link
-	CreatedAt      time.Time `json:"created_at"`
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	CID            string     `gorm:"column:cid;index" json:"cid"`
+	Name           string     `gorm:"index:,collate:NOCASE" json:"name"`
+	Size           int64      `gorm:"index" json:"size"`
+	MimeType       string     `gorm:"index:,collate:NOCASE" json:"mime_type"`
+	EncryptionType string     `gorm:"index" json:"encryption_type"`
+	EncryptionMeta string     `json:"encryption_meta"`
+	OriginalLink   string     `json:"original_link"` // Store the full Mochi Link
+	SignedBy       string     `json:"signed_by"`     // Verified signer of a v2 link (Ed25519 Hex)
+	BundleCID      string     `json:"bundle_cid"`    // Manifest CID if imported from a share bundle
+	ExpiresAt      *time.Time `json:"expires_at"`    // exp claim of the link, nil = never
+	Note           string     `json:"note"`          // User note, searchable
+	Expired        bool       `gorm:"-" json:"expired"`
+	Tags           []string   `gorm:"-" json:"tags"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+}
+
+// IssuedShare is a ledger entry for a link we generated, so shares can be
+// audited after the link has left the app
+type IssuedShare struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	FileID       uint       `gorm:"index" json:"file_id"`
+	CID          string     `gorm:"column:cid" json:"cid"`
+	PayloadHash  string     `gorm:"index" json:"payload_hash"` // SHA-256 Hex of the link payload JSON
+	Mode         string     `json:"mode"`                      // public, password, private
+	RecipientKey string     `json:"recipient_key"`             // Recipient Ed25519 Hex keys, comma separated
+	Signed       bool       `json:"signed"`
+	BundleCID    string     `json:"bundle_cid"` // Set when the file was shared inside a bundle
+	ShortCID     string     `json:"short_cid"`  // Pinned object behind a short link
+	ExpiresAt    *time.Time `json:"expires_at"`
+	Note         string     `json:"note"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Trust levels of a contact
+const (
+	TrustUntrusted = "untrusted"
+	TrustKnown     = "known"
+	TrustTrusted   = "trusted"
+)
+
+// Contact is an address book entry for another MochiBox user
+type Contact struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Name       string    `json:"name"`
+	PublicKey  string    `gorm:"uniqueIndex" json:"public_key"` // Ed25519 Hex, lower case
+	PeerIDs    string    `json:"peer_ids"`                      // Known libp2p peer IDs, comma separated
+	Addrs      string    `json:"addrs"`                         // Known multiaddrs, comma separated
+	TrustLevel string    `json:"trust_level"`                   // untrusted, known, trusted
+	Notes      string    `json:"notes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Inbox item states
+const (
+	InboxPending   = "pending"
+	InboxAccepted  = "accepted"
+	InboxDismissed = "dismissed"
+)
+
+// InboxItem is a share notice received over pubsub
+type InboxItem struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	NoticeID     string    `gorm:"uniqueIndex" json:"notice_id"` // Hash of the sealed notice, for dedup
+	Recipient    string    `gorm:"index" json:"recipient"`       // Our Ed25519 Hex it was sealed to
+	SenderKey    string    `gorm:"index" json:"sender_key"`      // Verified sender Ed25519 Hex
+	SenderPeer   string    `json:"sender_peer"`                  // libp2p peer that published it
+	Link         string    `json:"link"`
+	Note         string    `json:"note"`
+	CID          string    `gorm:"column:cid" json:"cid"` // Empty for short links until accepted
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	Status       string    `gorm:"index" json:"status"` // pending, accepted, dismissed
+	SharedFileID uint      `json:"shared_file_id"`      // Set once accepted
+	SentAt       time.Time `json:"sent_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// FeedEntry is a public file listed in the feed of one of our identities
+type FeedEntry struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Owner       string    `gorm:"uniqueIndex:idx_feed_owner_file" json:"owner"` // Identity Ed25519 Hex
+	FileID      uint      `gorm:"uniqueIndex:idx_feed_owner_file" json:"file_id"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// FeedPublication is the last IPNS publish of an identity's feed
+type FeedPublication struct {
+	Owner       string    `gorm:"primaryKey" json:"owner"` // Identity Ed25519 Hex
+	Name        string    `json:"name"`                    // IPNS name of the feed key
+	CID         string    `gorm:"column:cid" json:"cid"`   // Signed feed object
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Follow is another user's feed we poll
+type Follow struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Name        string     `gorm:"uniqueIndex" json:"name"` // IPNS name
+	Label       string     `json:"label"`
+	PublicKey   string     `json:"public_key"`            // Feed signer seen first; later feeds must match
+	CID         string     `gorm:"column:cid" json:"cid"` // Last resolved feed object
+	Owner       string     `json:"owner"`                 // Display name from the feed
+	LastChecked *time.Time `json:"last_checked"`
+	LastError   string     `json:"last_error"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// SubscriptionItem is a file seen in a followed feed
+type SubscriptionItem struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	FollowID    uint      `gorm:"uniqueIndex:idx_sub_follow_cid" json:"follow_id"`
+	CID         string    `gorm:"column:cid;uniqueIndex:idx_sub_follow_cid" json:"cid"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	MimeType    string    `json:"mime_type"`
+	Description string    `json:"description"`
+	AddedAt     time.Time `json:"added_at"` // When the publisher listed it
+	Seen        bool      `gorm:"index" json:"seen"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type Account struct {
-	ID            uint   `gorm:"primaryKey" json:"id"`
-	PublicKey     string `json:"public_key"`     // Ed25519 Hex
-	Name          string `json:"name"`
-	Avatar        string `json:"avatar"`
-	EncryptedSeed string `json:"-"`              // Base64 encrypted seed (by MasterPassword)
-	Salt          string `json:"-"`              // Hex salt for MasterPassword
-	IsInitialized bool   `json:"is_initialized"` // Helper
+	ID               uint   `gorm:"primaryKey" json:"id"`
+	PublicKey        string `json:"public_key"` // Ed25519 Hex
+	Name             string `json:"name"`
+	Avatar           string `json:"avatar"`
+	EncryptedSeed    string `json:"-"`              // Base64 encrypted seed (by MasterPassword)
+	Salt             string `json:"-"`              // KDF salt with Argon2 params for MasterPassword (legacy: bare hex)
+	HasPassphrase    bool   `json:"has_passphrase"` // Seed derived with a BIP39 passphrase (never stored)
+	ActiveIdentityID uint   `json:"active_identity_id"`
+	Identity         string `gorm:"-" json:"identity"` // Active identity name (filled by GetProfile)
+	IsInitialized    bool   `json:"is_initialized"`    // Helper
+}
+
+// Identity is a keypair derived from the account mnemonic. The root identity is
+// the original seed key; the others use SLIP-0010 at m/44'/5381'/Index'.
+type Identity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex" json:"name"`
+	Index     uint32    `gorm:"column:key_index" json:"index"`
+	Root      bool      `json:"root"`
+	PublicKey string    `json:"public_key"` // Ed25519 Hex
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Settings struct {
@@ -50,6 +228,31 @@ type Settings struct {
 	IpfsApiUrl      string `json:"ipfs_api_url"`
 	IpfsGatewayUrl  string `json:"ipfs_gateway_url"`
 	UseEmbeddedNode bool   `json:"use_embedded_node"`
+	RememberDays    int    `json:"remember_days"`   // "Remember me" lifetime; 0 = DefaultRememberDays
+	TrashDays       int    `json:"trash_days"`      // Trash retention; 0 = DefaultTrashDays
+	AnnounceNearby  bool   `json:"announce_nearby"` // Announce our presence to MochiBox users on the LAN
+}
+
+const DefaultRememberDays = 30
+
+const DefaultTrashDays = 30
+
+// RememberDuration is how long an auth.lock stays valid for auto-unlock
+func (s Settings) RememberDuration() time.Duration {
+	days := s.RememberDays
+	if days <= 0 {
+		days = DefaultRememberDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// TrashRetention is how long deleted files stay restorable before they are purged
+func (s Settings) TrashRetention() time.Duration {
+	days := s.TrashDays
+	if days <= 0 {
+		days = DefaultTrashDays
+	}
+	return time.Duration(days) * 24 * time.Hour
 }
 
 func InitDB(path string) (*gorm.DB, error) {
@@ -58,10 +261,16 @@ func InitDB(path string) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&File{}, &Settings{}, &SharedFile{}, &Account{})
+	err = db.AutoMigrate(&File{}, &Settings{}, &SharedFile{}, &Account{}, &Identity{}, &IssuedShare{}, &Contact{}, &InboxItem{}, &FeedEntry{}, &FeedPublication{}, &Follow{}, &SubscriptionItem{}, &Folder{}, &Tag{}, &ItemTag{}, &PinRef{})
 	if err != nil {
 		return nil, err
 	}
+	if err := initSearch(db); err != nil {
+		return nil, err
+	}
+	if err := initPins(db); err != nil {
+		return nil, err
+	}
 
 	// Initialize default settings if not exists
 	var count int64
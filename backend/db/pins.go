@@ -0,0 +1,103 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// References from File rows are kept by triggers: a row holds its CID from
+// insert until it is hard deleted, so files in the trash keep their pins.
+// Other holders add and release their references explicitly.
+
+func pinSchema() []string {
+	return []string{
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS files_pin_ai AFTER INSERT ON files WHEN NEW.cid <> '' BEGIN INSERT OR IGNORE INTO pin_refs(cid, holder_type, holder_id, created_at) VALUES (NEW.cid, '%[1]s', CAST(NEW.id AS TEXT), CURRENT_TIMESTAMP); END`, PinFile),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS files_pin_ad AFTER DELETE ON files BEGIN DELETE FROM pin_refs WHERE holder_type = '%[1]s' AND holder_id = CAST(OLD.id AS TEXT); END`, PinFile),
+	}
+}
+
+// initPins creates the triggers and records references that predate them:
+// library files, bundle manifests and short links from the share ledger, and
+// published feeds
+func initPins(database *gorm.DB) error {
+	stmts := append(pinSchema(),
+		fmt.Sprintf(`INSERT OR IGNORE INTO pin_refs(cid, holder_type, holder_id, created_at) SELECT cid, '%s', CAST(id AS TEXT), created_at FROM files WHERE cid <> ''`, PinFile),
+	)
+	for _, stmt := range stmts {
+		if err := database.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("pin refs: %w", err)
+		}
+	}
+
+	var shares []IssuedShare
+	if err := database.Where("bundle_c_id <> '' OR short_c_id <> ''").Find(&shares).Error; err != nil {
+		return fmt.Errorf("pin refs: %w", err)
+	}
+	var feeds []FeedPublication
+	if err := database.Where("cid <> ''").Find(&feeds).Error; err != nil {
+		return fmt.Errorf("pin refs: %w", err)
+	}
+	refs := make([]PinRef, 0)
+	for _, share := range shares {
+		if share.BundleCID != "" {
+			refs = append(refs, PinRef{CID: share.BundleCID, HolderType: PinBundle, HolderID: share.BundleCID, CreatedAt: share.CreatedAt})
+		}
+		if share.ShortCID != "" {
+			refs = append(refs, PinRef{CID: share.ShortCID, HolderType: PinShortLink, HolderID: share.ShortCID, CreatedAt: share.CreatedAt})
+		}
+	}
+	for _, feed := range feeds {
+		refs = append(refs, PinRef{CID: feed.CID, HolderType: PinFeed, HolderID: feed.Owner, CreatedAt: feed.PublishedAt})
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	if err := database.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(refs, 100).Error; err != nil {
+		return fmt.Errorf("pin refs: %w", err)
+	}
+	return nil
+}
+
+// AddPinRef records that holder needs cid pinned. Adding a reference twice
+// is a no-op.
+func AddPinRef(database *gorm.DB, cid, holderType, holderID string) error {
+	ref := PinRef{CID: cid, HolderType: holderType, HolderID: holderID, CreatedAt: time.Now()}
+	return database.Clauses(clause.OnConflict{DoNothing: true}).Create(&ref).Error
+}
+
+// RemovePinRef drops holder's reference to cid
+func RemovePinRef(database *gorm.DB, cid, holderType, holderID string) error {
+	return database.Where("cid = ? AND holder_type = ? AND holder_id = ?", cid, holderType, holderID).Delete(&PinRef{}).Error
+}
+
+// PinRefCount counts the references to cid
+func PinRefCount(database *gorm.DB, cid string) (int64, error) {
+	var count int64
+	err := database.Model(&PinRef{}).Where("cid = ?", cid).Count(&count).Error
+	return count, err
+}
+
+// OtherPinRefs counts the references to cid held by anything but the given holder
+func OtherPinRefs(database *gorm.DB, cid, holderType, holderID string) (int64, error) {
+	var count int64
+	err := database.Model(&PinRef{}).
+		Where("cid = ? AND NOT (holder_type = ? AND holder_id = ?)", cid, holderType, holderID).
+		Count(&count).Error
+	return count, err
+}
+
+// PinRefsByCID returns every reference, grouped by CID
+func PinRefsByCID(database *gorm.DB) (map[string][]PinRef, error) {
+	var refs []PinRef
+	if err := database.Order("cid, holder_type, holder_id").Find(&refs).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string][]PinRef)
+	for _, ref := range refs {
+		result[ref.CID] = append(result[ref.CID], ref)
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPinRefs_CountedPerCID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mochi.db")
+	database, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	first := File{CID: "bafysame", Name: "a.txt"}
+	second := File{CID: "bafysame", Name: "copy of a.txt"}
+	database.Create(&first)
+	database.Create(&second)
+	if err := AddPinRef(database, "bafysame", PinShortLink, "bafysame"); err != nil {
+		t.Fatalf("AddPinRef: %v", err)
+	}
+	if err := AddPinRef(database, "bafysame", PinShortLink, "bafysame"); err != nil {
+		t.Fatalf("AddPinRef twice: %v", err)
+	}
+
+	others := func(holderType, holderID string) int64 {
+		t.Helper()
+		n, err := OtherPinRefs(database, "bafysame", holderType, holderID)
+		if err != nil {
+			t.Fatalf("OtherPinRefs: %v", err)
+		}
+		return n
+	}
+	if n := others(PinFile, "1"); n != 2 {
+		t.Fatalf("refs besides first file: got %d, want 2", n)
+	}
+
+	// The trash keeps the reference; only a hard delete drops it
+	database.Delete(&first)
+	if n := others(PinShortLink, "bafysame"); n != 2 {
+		t.Fatalf("trashed file dropped its ref: got %d others", n)
+	}
+	database.Unscoped().Delete(&first)
+	database.Unscoped().Delete(&second)
+	if n := others(PinShortLink, "bafysame"); n != 0 {
+		t.Fatalf("refs of purged files left behind: %d", n)
+	}
+
+	// Rows that predate the triggers are picked up on the next start
+	database.Exec("DELETE FROM pin_refs")
+	database.Create(&IssuedShare{FileID: 9, CID: "bafyfile", BundleCID: "bafybundle"})
+	database.Exec("INSERT INTO files(cid, name, created_at) VALUES ('bafyold', 'old', CURRENT_TIMESTAMP)")
+	database.Exec("DELETE FROM pin_refs")
+	if database, err = InitDB(path); err != nil {
+		t.Fatalf("InitDB again: %v", err)
+	}
+	refs, err := PinRefsByCID(database)
+	if err != nil {
+		t.Fatalf("PinRefsByCID: %v", err)
+	}
+	if len(refs["bafyold"]) != 1 || refs["bafyold"][0].HolderType != PinFile {
+		t.Fatalf("file ref not backfilled: %+v", refs)
+	}
+	if len(refs["bafybundle"]) != 1 || refs["bafybundle"][0].HolderType != PinBundle {
+		t.Fatalf("bundle ref not backfilled: %+v", refs)
+	}
+}
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The search index is an FTS5 table with one row per file (rowid = id*2) and
+// per shared history entry (rowid = id*2+1). Triggers keep it in step with
+// the tables and their tags, and it is rebuilt on startup.
+
+const maxTagLength = 64
+
+// tagsOf selects the space separated tag names of the item aliased as alias
+func tagsOf(itemType, alias string) string {
+	return fmt.Sprintf("(SELECT group_concat(t.name, ' ') FROM item_tags it JOIN tags t ON t.id = it.tag_id WHERE it.item_type = '%s' AND it.item_id = %s.id)", itemType, alias)
+}
+
+// indexRows selects search index rows from table, optionally restricted by where
+func indexRows(table, itemType string, offset int, where string) string {
+	q := fmt.Sprintf("INSERT INTO search_index(rowid, name, tags, mime_type, note) SELECT x.id*2+%d, x.name, %s, x.mime_type, x.note FROM %s x",
+		offset, tagsOf(itemType, "x"), table)
+	if where != "" {
+		q += " WHERE " + where
+	}
+	return q
+}
+
+// itemRowID is the search index rowid of an item_tags row
+const itemRowID = "item_id*2 + (item_type = '" + ItemShared + "')"
+
+func searchSchema() []string {
+	stmts := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(name, tags, mime_type, note, tokenize = 'unicode61 remove_diacritics 2')`,
+	}
+	for _, t := range []struct {
+		table, itemType string
+		offset          int
+	}{{"files", ItemFile, 0}, {"shared_files", ItemShared, 1}} {
+		old := fmt.Sprintf("OLD.id*2+%d", t.offset)
+		stmts = append(stmts,
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_search_ai AFTER INSERT ON %[1]s BEGIN %[2]s; END`,
+				t.table, indexRows(t.table, t.itemType, t.offset, "x.id = NEW.id")),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_search_au AFTER UPDATE ON %[1]s BEGIN DELETE FROM search_index WHERE rowid = %[2]s; %[3]s; END`,
+				t.table, old, indexRows(t.table, t.itemType, t.offset, "x.id = NEW.id")),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_search_ad AFTER DELETE ON %[1]s BEGIN DELETE FROM item_tags WHERE item_type = '%[2]s' AND item_id = OLD.id; DELETE FROM search_index WHERE rowid = %[3]s; END`,
+				t.table, t.itemType, old),
+		)
+	}
+
+	// Re-index an item when its tags change, and every tagged item on rename
+	refreshItem := func(ref string) string {
+		return fmt.Sprintf("DELETE FROM search_index WHERE rowid = %[1]s.item_id*2 + (%[1]s.item_type = '%[2]s'); %[3]s; %[4]s",
+			ref, ItemShared,
+			indexRows("files", ItemFile, 0, fmt.Sprintf("%s.item_type = '%s' AND x.id = %s.item_id", ref, ItemFile, ref)),
+			indexRows("shared_files", ItemShared, 1, fmt.Sprintf("%s.item_type = '%s' AND x.id = %s.item_id", ref, ItemShared, ref)))
+	}
+	tagged := func(itemType string) string {
+		return fmt.Sprintf("x.id IN (SELECT item_id FROM item_tags WHERE tag_id = NEW.id AND item_type = '%s')", itemType)
+	}
+	stmts = append(stmts,
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS item_tags_search_ai AFTER INSERT ON item_tags BEGIN %s; END`, refreshItem("NEW")),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS item_tags_search_ad AFTER DELETE ON item_tags BEGIN %s; END`, refreshItem("OLD")),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS tags_search_au AFTER UPDATE OF name ON tags BEGIN DELETE FROM search_index WHERE rowid IN (SELECT %s FROM item_tags WHERE tag_id = NEW.id); %s; %s; END`,
+			itemRowID, indexRows("files", ItemFile, 0, tagged(ItemFile)), indexRows("shared_files", ItemShared, 1, tagged(ItemShared))),
+	)
+	return stmts
+}
+
+// initSearch creates the search index and its triggers and rebuilds it
+func initSearch(database *gorm.DB) error {
+	for _, stmt := range searchSchema() {
+		if err := database.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("search index: %w", err)
+		}
+	}
+	return database.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			"DELETE FROM search_index",
+			indexRows("files", ItemFile, 0, ""),
+			indexRows("shared_files", ItemShared, 1, ""),
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("search index: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// NormalizeTags lower-cases, trims and de-duplicates tag names
+func NormalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if len(name) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", name, maxTagLength)
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// SetTags replaces the tags of an item, creating tags that don't exist yet
+func SetTags(database *gorm.DB, itemType string, itemID uint, names []string) ([]string, error) {
+	names, err := NormalizeTags(names)
+	if err != nil {
+		return nil, err
+	}
+	err = database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("item_type = ? AND item_id = ?", itemType, itemID).Delete(&ItemTag{}).Error; err != nil {
+			return err
+		}
+		for _, name := range names {
+			tag := Tag{Name: name}
+			if err := tx.Where(Tag{Name: name}).Attrs(Tag{CreatedAt: time.Now()}).FirstOrCreate(&tag).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&ItemTag{TagID: tag.ID, ItemType: itemType, ItemID: itemID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return names, err
+}
+
+// TagsFor returns the tag names of items, keyed by item ID
+func TagsFor(database *gorm.DB, itemType string, ids []uint) (map[uint][]string, error) {
+	result := make(map[uint][]string)
+	if len(ids) == 0 {
+		return result, nil
+	}
+	var rows []struct {
+		ItemID uint
+		Name   string
+	}
+	err := database.Table("item_tags").Select("item_tags.item_id, tags.name").
+		Joins("JOIN tags ON tags.id = item_tags.tag_id").
+		Where("item_tags.item_type = ? AND item_tags.item_id IN ?", itemType, ids).
+		Order("tags.name").Scan(&rows).Error
+	for _, row := range rows {
+		result[row.ItemID] = append(result[row.ItemID], row.Name)
+	}
+	return result, err
+}
+
+// SearchFilter narrows a search. Zero values don't filter.
+type SearchFilter struct {
+	Query          string     // Free text, matched as prefixes against names, tags, MIME types and notes
+	Scope          string     // ItemFile, ItemShared or "" for both
+	EncryptionType string     // public, password, private
+	MinSize        int64      // Bytes
+	MaxSize        int64      // Bytes
+	From           *time.Time // created_at lower bound
+	To             *time.Time // created_at upper bound
+	Kind           string     // "file" or "folder"
+	Tag            string
+	Limit          int
+}
+
+// SearchHit is one ranked result. Lower scores rank higher (FTS5 bm25).
+type SearchHit struct {
+	Source string  `json:"source"` // ItemFile or ItemShared
+	ID     uint    `json:"id"`
+	Score  float64 `json:"score"`
+}
+
+// MatchQuery turns free text into an FTS5 query of prefix terms that must all match
+func MatchQuery(text string) string {
+	terms := make([]string, 0)
+	for _, word := range strings.Fields(text) {
+		word = strings.ReplaceAll(word, `"`, `""`)
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// Search ranks files and shared history entries across both tables. Without
+// a query, matches are ordered newest first.
+func Search(database *gorm.DB, f SearchFilter) ([]SearchHit, error) {
+	match := MatchQuery(f.Query)
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+
+	var parts []string
+	var args []interface{}
+	for _, t := range []struct {
+		table, itemType string
+		offset          int
+	}{{"files", ItemFile, 0}, {"shared_files", ItemShared, 1}} {
+		if f.Scope != "" && f.Scope != t.itemType {
+			continue
+		}
+		var where []string
+		var partArgs []interface{}
+		var sql string
+		if match != "" {
+			sql = fmt.Sprintf("SELECT '%s' AS source, x.id AS id, bm25(search_index, 10.0, 5.0, 1.0, 2.0) AS score, x.created_at AS created_at FROM search_index JOIN %s x ON x.id = search_index.rowid / 2", t.itemType, t.table)
+			where = append(where, "search_index MATCH ?", fmt.Sprintf("search_index.rowid %% 2 = %d", t.offset))
+			partArgs = append(partArgs, match)
+		} else {
+			sql = fmt.Sprintf("SELECT '%s' AS source, x.id AS id, 0.0 AS score, x.created_at AS created_at FROM %s x", t.itemType, t.table)
+		}
+
+		if t.itemType == ItemFile {
+			// Files in the trash stay indexed but are not found
+			where = append(where, "x.deleted_at IS NULL")
+		}
+		if f.EncryptionType != "" {
+			where = append(where, "x.encryption_type = ?")
+			partArgs = append(partArgs, f.EncryptionType)
+		}
+		if f.MinSize > 0 {
+			where = append(where, "x.size >= ?")
+			partArgs = append(partArgs, f.MinSize)
+		}
+		if f.MaxSize > 0 {
+			where = append(where, "x.size <= ?")
+			partArgs = append(partArgs, f.MaxSize)
+		}
+		if f.From != nil {
+			where = append(where, "x.created_at >= ?")
+			partArgs = append(partArgs, *f.From)
+		}
+		if f.To != nil {
+			where = append(where, "x.created_at <= ?")
+			partArgs = append(partArgs, *f.To)
+		}
+		isFolder := "x.mime_type = 'inode/directory'"
+		if t.itemType == ItemFile {
+			isFolder = "(x.is_folder = 1 OR x.mime_type = 'inode/directory')"
+		}
+		switch f.Kind {
+		case "folder":
+			where = append(where, isFolder)
+		case "file":
+			where = append(where, "NOT "+isFolder)
+		}
+		if f.Tag != "" {
+			where = append(where, fmt.Sprintf("EXISTS (SELECT 1 FROM item_tags it JOIN tags t ON t.id = it.tag_id WHERE it.item_type = '%s' AND it.item_id = x.id AND t.name = ?)", t.itemType))
+			partArgs = append(partArgs, strings.ToLower(strings.TrimSpace(f.Tag)))
+		}
+
+		if len(where) > 0 {
+			sql += " WHERE " + strings.Join(where, " AND ")
+		}
+		parts = append(parts, sql)
+		args = append(args, partArgs...)
+	}
+
+	hits := make([]SearchHit, 0)
+	if len(parts) == 0 {
+		return hits, nil
+	}
+	query := "SELECT source, id, score FROM (" + strings.Join(parts, " UNION ALL ") + ") ORDER BY score, created_at DESC LIMIT ?"
+	args = append(args, f.Limit)
+	err := database.Raw(query, args...).Scan(&hits).Error
+	return hits, err
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSearch_IndexAndFilters(t *testing.T) {
+	database, err := InitDB(filepath.Join(t.TempDir(), "mochi.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	report := File{CID: "bafyreport", Name: "Quarterly Report.pdf", Size: 2048, MimeType: "application/pdf", EncryptionType: "public"}
+	photos := File{CID: "bafyphotos", Name: "holiday", Size: 1 << 20, EncryptionType: "private", IsFolder: true, Note: "beach trip"}
+	database.Create(&report)
+	database.Create(&photos)
+	shared := SharedFile{CID: "bafyshared", Name: "report-draft.docx", Size: 512, EncryptionType: "public"}
+	database.Create(&shared)
+
+	search := func(f SearchFilter) []SearchHit {
+		t.Helper()
+		hits, err := Search(database, f)
+		if err != nil {
+			t.Fatalf("Search(%+v): %v", f, err)
+		}
+		return hits
+	}
+
+	if hits := search(SearchFilter{Query: "repo"}); len(hits) != 2 {
+		t.Fatalf("prefix search across tables: got %+v", hits)
+	}
+	if hits := search(SearchFilter{Query: "repo", Scope: ItemShared}); len(hits) != 1 || hits[0].Source != ItemShared || hits[0].ID != shared.ID {
+		t.Fatalf("scoped search: got %+v", hits)
+	}
+	if hits := search(SearchFilter{Query: "beach"}); len(hits) != 1 || hits[0].ID != photos.ID {
+		t.Fatalf("note search: got %+v", hits)
+	}
+	if hits := search(SearchFilter{Kind: "folder"}); len(hits) != 1 || hits[0].ID != photos.ID {
+		t.Fatalf("folder filter: got %+v", hits)
+	}
+	if hits := search(SearchFilter{MinSize: 1024, EncryptionType: "public"}); len(hits) != 1 || hits[0].ID != report.ID {
+		t.Fatalf("size and encryption filter: got %+v", hits)
+	}
+
+	// Tags are indexed, follow renames and go away with the item
+	if _, err := SetTags(database, ItemFile, report.ID, []string{" Finance ", "finance", "Q3"}); err != nil {
+		t.Fatalf("SetTags: %v", err)
+	}
+	if hits := search(SearchFilter{Query: "financ"}); len(hits) != 1 || hits[0].ID != report.ID {
+		t.Fatalf("tag search: got %+v", hits)
+	}
+	if hits := search(SearchFilter{Tag: "q3"}); len(hits) != 1 {
+		t.Fatalf("tag filter: got %+v", hits)
+	}
+	database.Model(&Tag{}).Where("name = ?", "finance").Update("name", "accounting")
+	if hits := search(SearchFilter{Query: "accounting"}); len(hits) != 1 {
+		t.Fatalf("renamed tag search: got %+v", hits)
+	}
+	tags, _ := TagsFor(database, ItemFile, []uint{report.ID})
+	if len(tags[report.ID]) != 2 {
+		t.Fatalf("TagsFor: got %v", tags)
+	}
+
+	database.Model(&report).Update("name", "Annual summary.pdf")
+	if hits := search(SearchFilter{Query: "annual"}); len(hits) != 1 {
+		t.Fatalf("renamed file search: got %+v", hits)
+	}
+	database.Delete(&report)
+	if hits := search(SearchFilter{Query: "annual"}); len(hits) != 0 {
+		t.Fatalf("trashed file still found: %+v", hits)
+	}
+	var count int64
+	database.Model(&ItemTag{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("tags of trashed file dropped: %d", count)
+	}
+	database.Unscoped().Delete(&report)
+	database.Model(&ItemTag{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("tags of deleted file left behind: %d", count)
+	}
+
+	if _, err := Search(database, SearchFilter{Query: `"unbalanced AND (`}); err != nil {
+		t.Fatalf("query syntax leaked into FTS5: %v", err)
+	}
+}
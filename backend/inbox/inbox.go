@@ -0,0 +1,150 @@
+// Package inbox implements the notices MochiBox users send each other over
+// pubsub when they share a file.
+//
+// A notice is signed by the sender, names its recipient, and is sealed
+// (anonymous NaCl box) to the recipient's key before it is published on the
+// recipient's topic. Only the recipient can read it, and it cannot be
+// re-addressed to someone else without breaking the signature.
+package inbox
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mochibox-core/crypto"
+)
+
+// TopicPrefix is followed by the SHA-256 Hex of the recipient's public key, so
+// the topic name does not spell out the key
+const TopicPrefix = "/mochibox/inbox/1/"
+
+// MaxMessageSize bounds a sealed notice; links are small
+const MaxMessageSize = 64 * 1024
+
+var (
+	ErrInvalidNotice   = errors.New("invalid inbox notice")
+	ErrInvalidSig      = errors.New("invalid notice signature")
+	ErrNotForRecipient = errors.New("notice addressed to another key")
+)
+
+// Notice tells a recipient that a file was shared with them
+type Notice struct {
+	V      int       `json:"v"`
+	From   string    `json:"from"` // Sender Ed25519 Hex
+	To     string    `json:"to"`   // Recipient Ed25519 Hex
+	Link   string    `json:"link"` // Mochi link
+	Note   string    `json:"note,omitempty"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// signedNotice is what gets sealed
+type signedNotice struct {
+	Notice    string `json:"n"` // Base64 notice JSON
+	Signature string `json:"s"` // Hex
+}
+
+// Signer signs notices (AccountManager satisfies it)
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// Opener opens boxes sealed to the local key (AccountManager satisfies it)
+type Opener interface {
+	DecryptBox(encrypted []byte) ([]byte, error)
+}
+
+// Topic returns the pubsub topic of a recipient
+func Topic(pubKeyHex string) string {
+	pub, err := hex.DecodeString(strings.TrimSpace(pubKeyHex))
+	if err != nil {
+		pub = []byte(strings.ToLower(strings.TrimSpace(pubKeyHex)))
+	}
+	sum := sha256.Sum256(pub)
+	return TopicPrefix + hex.EncodeToString(sum[:])
+}
+
+// Seal signs the notice with signer (whose key must be n.From) and seals it to n.To
+func Seal(n Notice, signer Signer) ([]byte, error) {
+	if n.Link == "" || n.From == "" || n.To == "" {
+		return nil, fmt.Errorf("%w: missing link or keys", ErrInvalidNotice)
+	}
+	n.V = 1
+	n.From, n.To = strings.ToLower(n.From), strings.ToLower(n.To)
+	if n.SentAt.IsZero() {
+		n.SentAt = time.Now().UTC()
+	}
+
+	to, err := hex.DecodeString(n.To)
+	if err != nil || len(to) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: invalid recipient key", ErrInvalidNotice)
+	}
+	curvePub, err := crypto.Ed25519PublicKeyToCurve25519(to)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signer.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := json.Marshal(signedNotice{
+		Notice:    base64.StdEncoding.EncodeToString(data),
+		Signature: hex.EncodeToString(sig),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crypto.EncryptSessionKey(curvePub, inner)
+}
+
+// Open decrypts a sealed notice, checks the sender's signature and that it is
+// addressed to self (Ed25519 Hex). It returns the notice and an ID that stays
+// the same if the message is delivered twice.
+func Open(msg []byte, opener Opener, self string) (*Notice, string, error) {
+	if len(msg) > MaxMessageSize {
+		return nil, "", fmt.Errorf("%w: too large", ErrInvalidNotice)
+	}
+	inner, err := opener.DecryptBox(msg)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidNotice, err)
+	}
+
+	var signed signedNotice
+	if err := json.Unmarshal(inner, &signed); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidNotice, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(signed.Notice)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidNotice, err)
+	}
+	var n Notice
+	if err := json.Unmarshal(data, &n); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidNotice, err)
+	}
+
+	from, err := hex.DecodeString(n.From)
+	if err != nil || len(from) != ed25519.PublicKeySize {
+		return nil, "", ErrInvalidSig
+	}
+	sig, err := hex.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(from, data, sig) {
+		return nil, "", ErrInvalidSig
+	}
+	if !strings.EqualFold(n.To, self) {
+		return nil, "", ErrNotForRecipient
+	}
+
+	sum := sha256.Sum256(inner)
+	return &n, hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,61 @@
+package inbox
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"mochibox-core/crypto"
+)
+
+type testKey struct {
+	priv ed25519.PrivateKey
+}
+
+func (k testKey) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(k.priv, data), nil
+}
+
+func (k testKey) DecryptBox(encrypted []byte) ([]byte, error) {
+	w := &crypto.Wallet{PrivateKey: k.priv, PublicKey: k.priv.Public().(ed25519.PublicKey)}
+	return w.DecryptSessionKey(encrypted)
+}
+
+func TestSealOpen(t *testing.T) {
+	senderPub, senderPriv, _ := ed25519.GenerateKey(nil)
+	recipientPub, recipientPriv, _ := ed25519.GenerateKey(nil)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(nil)
+	sender, recipient := hex.EncodeToString(senderPub), hex.EncodeToString(recipientPub)
+
+	msg, err := Seal(Notice{From: sender, To: recipient, Link: "mochi://bafyshort", Note: "for you"}, testKey{senderPriv})
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	n, id, err := Open(msg, testKey{recipientPriv}, recipient)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if n.From != sender || n.Link != "mochi://bafyshort" || n.Note != "for you" || id == "" {
+		t.Fatalf("unexpected notice %+v", n)
+	}
+
+	// Someone else cannot read it
+	if _, _, err := Open(msg, testKey{otherPriv}, hex.EncodeToString(otherPub)); !errors.Is(err, ErrInvalidNotice) {
+		t.Fatalf("expected ErrInvalidNotice, got %v", err)
+	}
+
+	// A notice signed by one key but claiming another sender
+	forged, err := Seal(Notice{From: sender, To: recipient, Link: "mochi://bafyforged"}, testKey{otherPriv})
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if _, _, err := Open(forged, testKey{recipientPriv}, recipient); !errors.Is(err, ErrInvalidSig) {
+		t.Fatalf("expected ErrInvalidSig, got %v", err)
+	}
+
+	if Topic(recipient) == Topic(sender) || Topic(recipient) != Topic(recipient) {
+		t.Fatal("topics must be per recipient and stable")
+	}
+}
@@ -0,0 +1,58 @@
+package link
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mochibox-core/db"
+)
+
+// Manifest lists the files of a share bundle. It is stored on IPFS as a signed
+// envelope (optionally encrypted) and a link with Bundle set points at it.
+// Items use the same fields as single-file link payloads.
+type Manifest struct {
+	V         int       `json:"v"`
+	Name      string    `json:"name,omitempty"`
+	Items     []Payload `json:"items"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewManifest builds a manifest for files from My Files
+func NewManifest(name string, files []db.File) Manifest {
+	m := Manifest{V: 1, Name: name, CreatedAt: time.Now().UTC()}
+	for _, f := range files {
+		m.Items = append(m.Items, ForFile(f))
+	}
+	return m
+}
+
+// SignManifest serializes the manifest inside a signed envelope
+func SignManifest(m Manifest, signer Signer, pubKeyHex string) ([]byte, error) {
+	if len(m.Items) == 0 {
+		return nil, fmt.Errorf("bundle has no items")
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return signEnvelope(data, signer, pubKeyHex)
+}
+
+// OpenManifest verifies a signed manifest and returns it with its signer key
+func OpenManifest(signed []byte, verifier Verifier) (*Manifest, string, error) {
+	data, signedBy, err := openEnvelope(signed, verifier)
+	if err != nil {
+		return nil, "", err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, "", fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	for i, item := range m.Items {
+		if item.CID == "" {
+			return nil, "", fmt.Errorf("invalid bundle manifest: item %d has no CID", i)
+		}
+	}
+	return &m, signedBy, nil
+}
@@ -0,0 +1,62 @@
+package link
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MaxFeedSize bounds what a follower reads when resolving a feed
+const MaxFeedSize = 1024 * 1024
+
+// Feed is an account's list of public files. It is stored on IPFS as a signed
+// envelope and published under an IPNS name owned by the account's feed key.
+type Feed struct {
+	V         int        `json:"v"`
+	Owner     string     `json:"owner,omitempty"` // Account display name
+	Items     []FeedItem `json:"items"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// FeedItem is one public file in a feed
+type FeedItem struct {
+	CID         string    `json:"c"`
+	Name        string    `json:"n"`
+	Size        int64     `json:"s,omitempty"`
+	MimeType    string    `json:"m,omitempty"`
+	Description string    `json:"d,omitempty"`
+	AddedAt     time.Time `json:"at"`
+}
+
+// SignFeed serializes the feed inside a signed envelope
+func SignFeed(f Feed, signer Signer, pubKeyHex string) ([]byte, error) {
+	if f.Items == nil {
+		f.Items = []FeedItem{}
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFeedSize {
+		return nil, fmt.Errorf("feed too large: %d bytes", len(data))
+	}
+	return signEnvelope(data, signer, pubKeyHex)
+}
+
+// OpenFeed verifies a signed feed and returns it with its signer key
+func OpenFeed(signed []byte, verifier Verifier) (*Feed, string, error) {
+	data, signedBy, err := openEnvelope(signed, verifier)
+	if err != nil {
+		return nil, "", err
+	}
+	var f Feed
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, "", fmt.Errorf("invalid feed: %w", err)
+	}
+	for i, item := range f.Items {
+		if item.CID == "" {
+			return nil, "", fmt.Errorf("invalid feed: item %d has no CID", i)
+		}
+	}
+	return &f, signedBy, nil
+}
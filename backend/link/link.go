@@ -0,0 +1,334 @@
+// Package link encodes and decodes Mochi share links.
+//
+// A v1 link is mochi://BASE64(JSON payload). A v2 link wraps the payload in a
+// signed envelope: mochi://BASE64({"v":2,"p":BASE64(payload),"k":pubhex,"s":sighex}),
+// where the Ed25519 signature covers the payload JSON bytes.
+//
+// Payloads may carry iat/exp/nbf claims (Unix seconds). In a v2 link they are
+// covered by the signature; in a v1 link anyone can edit them, so v1 links are
+// reported as unverifiable.
+package link
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mochibox-core/db"
+)
+
+const Scheme = "mochi://"
+
+// Short encryption types used inside links
+const (
+	TypePublic   = "pub"
+	TypePassword = "pwd"
+	TypePrivate  = "priv"
+)
+
+var (
+	ErrInvalidLink      = errors.New("invalid mochi link")
+	ErrInvalidSignature = errors.New("invalid link signature")
+	ErrExpired          = errors.New("link expired")
+	ErrNotYetValid      = errors.New("link not yet valid")
+)
+
+// Params carries the decryption material of an encrypted link
+type Params struct {
+	Salt         string `json:"salt,omitempty"` // Password mode KDF salt
+	Password     string `json:"pw,omitempty"`   // Password mode, only if the sharer chose to embed it
+	EncryptedKey string `json:"ek,omitempty"`   // Private mode recipient key list
+}
+
+// Payload is the v1 link body
+type Payload struct {
+	V        int      `json:"v"`
+	CID      string   `json:"c"`
+	Name     string   `json:"n,omitempty"` // Omitted when sealed inside the file
+	Size     int64    `json:"s,omitempty"`
+	Type     string   `json:"t"` // pub, pwd, priv
+	MimeType string   `json:"m,omitempty"`
+	Params   *Params  `json:"p,omitempty"`
+	PeerID   string   `json:"pid,omitempty"`
+	Peers    []string `json:"peers,omitempty"`
+	Bundle   bool     `json:"b,omitempty"` // CID is a bundle manifest, not a file
+
+	IssuedAt  int64 `json:"iat,omitempty"` // Unix seconds
+	ExpiresAt int64 `json:"exp,omitempty"` // Unix seconds, 0 = never
+	NotBefore int64 `json:"nbf,omitempty"` // Unix seconds, 0 = immediately
+}
+
+// envelope is the signed v2 wrapper
+type envelope struct {
+	V         int    `json:"v"`
+	Payload   string `json:"p"` // Base64 payload JSON
+	PublicKey string `json:"k"` // Ed25519 Hex
+	Signature string `json:"s"` // Hex
+}
+
+// Link is a decoded link. SignedBy is set only when the signature verified.
+type Link struct {
+	Payload
+	SignedBy string
+	Raw      string
+}
+
+// Unverifiable reports whether nothing vouches for the link contents (v1)
+func (l *Link) Unverifiable() bool {
+	return l.SignedBy == ""
+}
+
+// Expiry returns the exp claim as a time, or nil if the link never expires
+func (p Payload) Expiry() *time.Time {
+	if p.ExpiresAt == 0 {
+		return nil
+	}
+	t := time.Unix(p.ExpiresAt, 0).UTC()
+	return &t
+}
+
+// CheckTime fails with ErrExpired or ErrNotYetValid if the link is not usable at now
+func (p Payload) CheckTime(now time.Time) error {
+	if p.ExpiresAt != 0 && !now.Before(time.Unix(p.ExpiresAt, 0)) {
+		return fmt.Errorf("%w at %s", ErrExpired, time.Unix(p.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	if p.NotBefore != 0 && now.Before(time.Unix(p.NotBefore, 0)) {
+		return fmt.Errorf("%w until %s", ErrNotYetValid, time.Unix(p.NotBefore, 0).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Signer signs link payloads (AccountManager satisfies it)
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier checks link signatures (AccountManager satisfies it)
+type Verifier interface {
+	Verify(data, signature, publicKey []byte) bool
+}
+
+// ForFile builds the payload for a file from My Files. Name, size and type stay
+// out of encrypted links when the file carries them in its sealed envelope.
+func ForFile(file db.File) Payload {
+	p := Payload{
+		V:        1,
+		CID:      file.CID,
+		Name:     file.Name,
+		Size:     file.Size,
+		Type:     ShortType(file.EncryptionType),
+		MimeType: file.MimeType,
+	}
+	if file.SealedMeta && p.Type != TypePublic {
+		p.Name, p.Size, p.MimeType = "", 0, ""
+	}
+	switch p.Type {
+	case TypePassword:
+		p.Params = &Params{Salt: file.EncryptionMeta}
+	case TypePrivate:
+		p.Params = &Params{EncryptedKey: file.EncryptionMeta}
+	}
+	return p
+}
+
+// ShortType maps db encryption types to link types
+func ShortType(encryptionType string) string {
+	switch encryptionType {
+	case "password":
+		return TypePassword
+	case "private":
+		return TypePrivate
+	default:
+		return TypePublic
+	}
+}
+
+// EncryptionType maps the link type back to the db encryption type
+func (p Payload) EncryptionType() string {
+	switch p.Type {
+	case TypePassword:
+		return "password"
+	case TypePrivate:
+		return "private"
+	default:
+		return "public"
+	}
+}
+
+// EncryptionMeta returns the salt or recipient key list for the link type
+func (p Payload) EncryptionMeta() string {
+	if p.Params == nil {
+		return ""
+	}
+	switch p.Type {
+	case TypePassword:
+		return p.Params.Salt
+	case TypePrivate:
+		return p.Params.EncryptedKey
+	}
+	return ""
+}
+
+// Encode renders an unsigned v1 link
+func Encode(p Payload) (string, error) {
+	data, err := marshalPayload(p)
+	if err != nil {
+		return "", err
+	}
+	return Scheme + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// EncodeSigned renders a v2 link signed by signer, whose public key is pubKeyHex
+func EncodeSigned(p Payload, signer Signer, pubKeyHex string) (string, error) {
+	data, err := marshalPayload(p)
+	if err != nil {
+		return "", err
+	}
+	env, err := signEnvelope(data, signer, pubKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return Scheme + base64.StdEncoding.EncodeToString(env), nil
+}
+
+// signEnvelope wraps data in a signed v2 envelope
+func signEnvelope(data []byte, signer Signer, pubKeyHex string) ([]byte, error) {
+	sig, err := signer.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{
+		V:         2,
+		Payload:   base64.StdEncoding.EncodeToString(data),
+		PublicKey: pubKeyHex,
+		Signature: hex.EncodeToString(sig),
+	})
+}
+
+// openEnvelope verifies a signed v2 envelope and returns its data and signer
+func openEnvelope(outer []byte, verifier Verifier) ([]byte, string, error) {
+	var env envelope
+	if err := json.Unmarshal(outer, &env); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidLink, err)
+	}
+	if env.Payload == "" || env.PublicKey == "" || env.Signature == "" {
+		return nil, "", fmt.Errorf("%w: incomplete signed envelope", ErrInvalidLink)
+	}
+	data, err := decodeBase64(env.Payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidLink, err)
+	}
+	sig, err := hex.DecodeString(env.Signature)
+	if err != nil {
+		return nil, "", ErrInvalidSignature
+	}
+	pub, err := hex.DecodeString(env.PublicKey)
+	if err != nil || verifier == nil || !verifier.Verify(data, sig, pub) {
+		return nil, "", ErrInvalidSignature
+	}
+	return data, strings.ToLower(env.PublicKey), nil
+}
+
+// Hash returns the SHA-256 Hex of the payload JSON, the same bytes a v2 link signs
+func Hash(p Payload) (string, error) {
+	data, err := marshalPayload(p)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func marshalPayload(p Payload) ([]byte, error) {
+	if p.CID == "" {
+		return nil, fmt.Errorf("%w: missing CID", ErrInvalidLink)
+	}
+	if p.V == 0 {
+		p.V = 1
+	}
+	if p.Type == "" {
+		p.Type = TypePublic
+	}
+	if p.ExpiresAt != 0 && p.NotBefore != 0 && p.ExpiresAt <= p.NotBefore {
+		return nil, fmt.Errorf("%w: expires before it becomes valid", ErrInvalidLink)
+	}
+	return json.Marshal(p)
+}
+
+// Decode parses a v1 or v2 link. Signed links are verified with verifier and
+// fail with ErrInvalidSignature if the signature does not match; verifier may
+// be nil only for callers that reject v2 links anyway. Time claims are not
+// checked here, see DecodeValid. Short links need their object fetched first
+// (see ParseShort and OpenObject) and fail here with ErrInvalidLink.
+func Decode(raw string, verifier Verifier) (*Link, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, Scheme) {
+		return nil, fmt.Errorf("%w: missing %s prefix", ErrInvalidLink, Scheme)
+	}
+	outer, err := decodeBase64(strings.TrimPrefix(raw, Scheme))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLink, err)
+	}
+
+	var probe struct {
+		V int `json:"v"`
+	}
+	if err := json.Unmarshal(outer, &probe); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLink, err)
+	}
+
+	l := &Link{Raw: raw}
+	payloadJSON := outer
+	if probe.V == 2 {
+		payloadJSON, l.SignedBy, err = openEnvelope(outer, verifier)
+		if err != nil {
+			return nil, err
+		}
+	} else if probe.V > 1 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidLink, probe.V)
+	}
+
+	if err := l.unmarshalPayload(payloadJSON); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Link) unmarshalPayload(data []byte) error {
+	if err := json.Unmarshal(data, &l.Payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidLink, err)
+	}
+	if l.CID == "" {
+		return fmt.Errorf("%w: missing CID", ErrInvalidLink)
+	}
+	return nil
+}
+
+// DecodeValid decodes a link and also rejects it if it is expired or not yet
+// valid at now
+func DecodeValid(raw string, verifier Verifier, now time.Time) (*Link, error) {
+	l, err := Decode(raw, verifier)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.CheckTime(now); err != nil {
+		return l, err
+	}
+	return l, nil
+}
+
+// decodeBase64 accepts standard and URL-safe alphabets, padded or not
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := enc.DecodeString(s); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("invalid base64")
+}
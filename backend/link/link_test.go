@@ -0,0 +1,241 @@
+package link
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testKey struct {
+	priv ed25519.PrivateKey
+}
+
+func (k testKey) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(k.priv, data), nil
+}
+
+type edVerifier struct{}
+
+func (edVerifier) Verify(data, sig, pub []byte) bool {
+	return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, data, sig)
+}
+
+func TestEncodeDecode_V1(t *testing.T) {
+	p := Payload{V: 1, CID: "bafytest", Name: "a.txt", Size: 3, Type: TypePassword, Params: &Params{Salt: "abcd"}, Peers: []string{"/ip4/1.2.3.4/tcp/4001/p2p/x"}}
+	raw, err := Encode(p)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	l, err := Decode(raw, edVerifier{})
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if l.CID != p.CID || l.Name != p.Name || l.EncryptionType() != "password" || l.EncryptionMeta() != "abcd" || l.SignedBy != "" {
+		t.Fatalf("unexpected link %+v", l)
+	}
+}
+
+func TestEncodeDecode_V2Signed(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	pubHex := hex.EncodeToString(pub)
+
+	raw, err := EncodeSigned(Payload{CID: "bafysigned", Type: TypePrivate, Params: &Params{EncryptedKey: "[]"}}, testKey{priv}, pubHex)
+	if err != nil {
+		t.Fatalf("EncodeSigned: %v", err)
+	}
+	l, err := Decode(raw, edVerifier{})
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if l.SignedBy != pubHex || l.CID != "bafysigned" || l.EncryptionType() != "private" {
+		t.Fatalf("unexpected link %+v", l)
+	}
+
+	// Signed by someone else's key
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	forged := strings.Replace(decodeOuter(t, raw), pubHex, hex.EncodeToString(otherPub), 1)
+	if _, err := Decode(Scheme+base64.StdEncoding.EncodeToString([]byte(forged)), edVerifier{}); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		"bafyplaincid",
+		"mochi://not base64!",
+		"mochi://" + base64.StdEncoding.EncodeToString([]byte(`{"v":1}`)),
+		"mochi://" + base64.StdEncoding.EncodeToString([]byte(`{"v":9,"c":"x"}`)),
+	} {
+		if _, err := Decode(raw, edVerifier{}); !errors.Is(err, ErrInvalidLink) {
+			t.Fatalf("%q: expected ErrInvalidLink, got %v", raw, err)
+		}
+	}
+}
+
+func decodeOuter(t *testing.T, raw string) string {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(raw, Scheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestManifest_SignAndOpen(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	m := Manifest{V: 1, Name: "holiday", Items: []Payload{
+		{V: 1, CID: "bafyone", Name: "a.jpg", Type: TypePublic},
+		{V: 1, CID: "bafytwo", Type: TypePrivate, Params: &Params{EncryptedKey: "[]"}},
+	}}
+	signed, err := SignManifest(m, testKey{priv}, hex.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("SignManifest: %v", err)
+	}
+
+	got, signedBy, err := OpenManifest(signed, edVerifier{})
+	if err != nil {
+		t.Fatalf("OpenManifest: %v", err)
+	}
+	if signedBy != hex.EncodeToString(pub) || len(got.Items) != 2 || got.Items[1].EncryptionType() != "private" {
+		t.Fatalf("unexpected manifest %+v", got)
+	}
+
+	tampered := []byte(strings.Replace(string(signed), `"s":"`, `"s":"00`, 1))
+	if _, _, err := OpenManifest(tampered, edVerifier{}); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestDecodeValid_TimeClaims(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	now := time.Unix(1_700_000_000, 0)
+
+	raw, err := EncodeSigned(Payload{CID: "bafytimed", IssuedAt: now.Unix(), NotBefore: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}, testKey{priv}, hex.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("EncodeSigned: %v", err)
+	}
+	l, err := DecodeValid(raw, edVerifier{}, now.Add(time.Minute))
+	if err != nil || l.Unverifiable() || l.Expiry().Unix() != now.Add(time.Hour).Unix() {
+		t.Fatalf("DecodeValid in window: %v %+v", err, l)
+	}
+	if _, err := DecodeValid(raw, edVerifier{}, now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	if _, err := DecodeValid(raw, edVerifier{}, now.Add(-time.Second)); !errors.Is(err, ErrNotYetValid) {
+		t.Fatalf("expected ErrNotYetValid, got %v", err)
+	}
+
+	// Extending the expiry breaks the signature
+	var env envelope
+	if err := json.Unmarshal([]byte(decodeOuter(t, raw)), &env); err != nil {
+		t.Fatal(err)
+	}
+	inner, _ := base64.StdEncoding.DecodeString(env.Payload)
+	inner = []byte(strings.Replace(string(inner), fmt.Sprint(now.Add(time.Hour).Unix()), fmt.Sprint(now.Add(48*time.Hour).Unix()), 1))
+	env.Payload = base64.StdEncoding.EncodeToString(inner)
+	outer, _ := json.Marshal(env)
+	if _, err := Decode(Scheme+base64.StdEncoding.EncodeToString(outer), edVerifier{}); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	v1, _ := Encode(Payload{CID: "bafyplain"})
+	if l, err := DecodeValid(v1, edVerifier{}, now); err != nil || !l.Unverifiable() || l.Expiry() != nil {
+		t.Fatalf("v1 link: %v %+v", err, l)
+	}
+}
+
+func TestShortLink_RoundTrip(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	obj, err := SignObject(Payload{CID: "bafyfull", Type: TypePrivate, Params: &Params{EncryptedKey: "[]"}}, testKey{priv}, hex.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("SignObject: %v", err)
+	}
+
+	const objectCID = "bafkreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy"
+	peers := []string{"/ip4/192.168.1.2/tcp/4001/p2p/12D3KooWtest"}
+	raw := EncodeShort(objectCID, peers)
+
+	gotCID, gotPeers, err := ParseShort(raw)
+	if err != nil || gotCID != objectCID || len(gotPeers) != 1 || gotPeers[0] != peers[0] {
+		t.Fatalf("ParseShort: %v %s %v", err, gotCID, gotPeers)
+	}
+	if _, err := Decode(raw, edVerifier{}); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("Decode of short link: expected ErrInvalidLink, got %v", err)
+	}
+
+	l, err := OpenObject(obj, edVerifier{}, raw)
+	if err != nil || l.CID != "bafyfull" || l.SignedBy != hex.EncodeToString(pub) || l.Raw != raw {
+		t.Fatalf("OpenObject: %v %+v", err, l)
+	}
+
+	full, _ := Encode(Payload{CID: "bafyfull"})
+	if IsShort(full) {
+		t.Fatal("full link reported as short")
+	}
+	unsigned, _ := json.Marshal(Payload{V: 1, CID: "bafyfull"})
+	if _, err := OpenObject(unsigned, edVerifier{}, raw); err == nil {
+		t.Fatal("expected unsigned object to be rejected")
+	}
+}
+
+func TestPackage_RoundTrip(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	obj, err := SignObject(Payload{CID: "bafyfull", Type: TypePublic, Name: "a.txt"}, testKey{priv}, hex.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("SignObject: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePackageHeader(&buf, obj); err != nil {
+		t.Fatalf("WritePackageHeader: %v", err)
+	}
+	buf.WriteString("car-bytes")
+
+	l, car, err := ReadPackageHeader(bytes.NewReader(buf.Bytes()), edVerifier{})
+	if err != nil || l.CID != "bafyfull" || l.SignedBy != hex.EncodeToString(pub) {
+		t.Fatalf("ReadPackageHeader: %v %+v", err, l)
+	}
+	rest, _ := io.ReadAll(car)
+	if string(rest) != "car-bytes" {
+		t.Fatalf("CAR reader at wrong offset: %q", rest)
+	}
+	// The embedded object is also an openable v2 link
+	if decoded, err := Decode(l.Raw, edVerifier{}); err != nil || decoded.CID != "bafyfull" {
+		t.Fatalf("Decode of package link: %v", err)
+	}
+
+	tampered := buf.Bytes()
+	tampered[len(PackageMagic)+10] ^= 1
+	if _, _, err := ReadPackageHeader(bytes.NewReader(tampered), edVerifier{}); err == nil {
+		t.Fatal("expected tampered package to be rejected")
+	}
+	if _, _, err := ReadPackageHeader(strings.NewReader("not a package"), edVerifier{}); !errors.Is(err, ErrInvalidPackage) {
+		t.Fatalf("expected ErrInvalidPackage, got %v", err)
+	}
+}
+
+func TestFeed_SignAndOpen(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	f := Feed{V: 1, Owner: "alice", Items: []FeedItem{{CID: "bafyone", Name: "talk.mp4", Description: "Slides and video"}}}
+	signed, err := SignFeed(f, testKey{priv}, hex.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("SignFeed: %v", err)
+	}
+
+	got, signedBy, err := OpenFeed(signed, edVerifier{})
+	if err != nil || signedBy != hex.EncodeToString(pub) || len(got.Items) != 1 || got.Items[0].Description != "Slides and video" {
+		t.Fatalf("OpenFeed: %v %+v", err, got)
+	}
+
+	tampered := []byte(strings.Replace(string(signed), `"s":"`, `"s":"00`, 1))
+	if _, _, err := OpenFeed(tampered, edVerifier{}); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
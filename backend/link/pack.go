@@ -0,0 +1,65 @@
+package link
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A .mochi package hands a share over offline. It starts with PackageMagic,
+// then the signed link object (the envelope a short link points at) prefixed
+// by its length as a big-endian uint32, then a CARv1 of the DAG behind the
+// link's CID. The object doubles as a v2 link, so an imported package is
+// recorded exactly as if that link had been opened.
+
+const (
+	PackageMagic = "MOCHIPKG/1\n"
+	PackageExt   = ".mochi"
+)
+
+var ErrInvalidPackage = errors.New("invalid mochi package")
+
+// WritePackageHeader writes the magic and signed object; the CAR follows
+func WritePackageHeader(w io.Writer, object []byte) error {
+	if len(object) == 0 || len(object) > MaxObjectSize {
+		return fmt.Errorf("%w: link object of %d bytes", ErrInvalidPackage, len(object))
+	}
+	if _, err := io.WriteString(w, PackageMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(object))); err != nil {
+		return err
+	}
+	_, err := w.Write(object)
+	return err
+}
+
+// ReadPackageHeader verifies the signed object of a package. The returned
+// reader is positioned at the start of the CAR.
+func ReadPackageHeader(r io.Reader, verifier Verifier) (*Link, io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(PackageMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != PackageMagic {
+		return nil, nil, fmt.Errorf("%w: bad header", ErrInvalidPackage)
+	}
+	var size uint32
+	if err := binary.Read(br, binary.BigEndian, &size); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+	if size == 0 || size > MaxObjectSize {
+		return nil, nil, fmt.Errorf("%w: link object of %d bytes", ErrInvalidPackage, size)
+	}
+	object := make([]byte, size)
+	if _, err := io.ReadFull(br, object); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPackage, err)
+	}
+
+	l, err := OpenObject(object, verifier, Scheme+base64.StdEncoding.EncodeToString(object))
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, br, nil
+}
@@ -0,0 +1,74 @@
+package link
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+// A short link is mochi://<cid>, optionally followed by ?peer=<multiaddr>
+// hints. The CID points at a signed v2 envelope stored on IPFS, so the link
+// stays small enough for chat clients and QR codes. Peer hints are kept
+// inline because the object itself has to be found before it can be read.
+
+// MaxObjectSize bounds what a resolver reads for a short link object
+const MaxObjectSize = 64 * 1024
+
+// SignObject serializes a payload as a signed envelope to store on IPFS
+func SignObject(p Payload, signer Signer, pubKeyHex string) ([]byte, error) {
+	data, err := marshalPayload(p)
+	if err != nil {
+		return nil, err
+	}
+	return signEnvelope(data, signer, pubKeyHex)
+}
+
+// EncodeShort renders a short link for a stored object
+func EncodeShort(objectCID string, peers []string) string {
+	raw := Scheme + objectCID
+	if len(peers) > 0 {
+		raw += "?" + url.Values{"peer": peers}.Encode()
+	}
+	return raw
+}
+
+// ParseShort returns the object CID and peer hints of a short link. Full
+// links fail with ErrInvalidLink.
+func ParseShort(raw string) (string, []string, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, Scheme) {
+		return "", nil, fmt.Errorf("%w: missing %s prefix", ErrInvalidLink, Scheme)
+	}
+	body, query, _ := strings.Cut(strings.TrimPrefix(raw, Scheme), "?")
+	c, err := cid.Decode(body)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: not a short link", ErrInvalidLink)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidLink, err)
+	}
+	return c.String(), values["peer"], nil
+}
+
+// IsShort reports whether raw is a short link
+func IsShort(raw string) bool {
+	_, _, err := ParseShort(raw)
+	return err == nil
+}
+
+// OpenObject verifies a short link object fetched from IPFS. Objects must be
+// signed; raw is the short link the object was resolved from.
+func OpenObject(data []byte, verifier Verifier, raw string) (*Link, error) {
+	payloadJSON, signedBy, err := openEnvelope(data, verifier)
+	if err != nil {
+		return nil, err
+	}
+	l := &Link{Raw: strings.TrimSpace(raw), SignedBy: signedBy}
+	if err := l.unmarshalPayload(payloadJSON); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
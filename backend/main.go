@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"io"
 	"log"
 	"os"
@@ -68,13 +69,12 @@ func main() {
 	accountMgr := core.NewAccountManager(database, dataDir)
 
 	// Try Auto-Unlock
-	if lockData, err := crypto.LoadAuthLock(dataDir); err == nil {
-		log.Println("Found auto-unlock data, attempting login...")
-		if err := accountMgr.Unlock(string(lockData)); err == nil {
-			log.Println("Auto-login successful")
-		} else {
-			log.Printf("Auto-login failed: %v", err)
-		}
+	if err := accountMgr.AutoUnlock(settings.RememberDuration()); err == nil {
+		log.Println("Auto-login successful")
+	} else if errors.Is(err, crypto.ErrAuthLockExpired) {
+		log.Println("Auto-unlock data expired, login required")
+	} else if !os.IsNotExist(err) {
+		log.Printf("Auto-login failed: %v", err)
 	}
 
 	// 3. Managed IPFS Node
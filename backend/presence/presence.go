@@ -0,0 +1,141 @@
+// Package presence implements the signed records MochiBox instances announce
+// to find each other on the local network.
+package presence
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Topic is the pubsub topic presence records are announced on. Gossip carries
+// records beyond the LAN, so receivers only accept them from peers they are
+// connected to over a LAN address, and announcing is opt-in.
+const Topic = "/mochibox/presence/1"
+
+// MaxAge is how old a record may be before it is ignored; announcers repeat
+// well within it
+const MaxAge = 2 * time.Minute
+
+var (
+	ErrInvalidRecord = errors.New("invalid presence record")
+	ErrInvalidSig    = errors.New("invalid presence signature")
+	ErrStale         = errors.New("stale presence record")
+)
+
+// Record announces a MochiBox user and where their node can be dialed
+type Record struct {
+	V         int       `json:"v"`
+	Name      string    `json:"name"`
+	PublicKey string    `json:"pk"`    // Ed25519 Hex
+	PeerID    string    `json:"pid"`   // libp2p peer ID of their node
+	Addrs     []string  `json:"addrs"` // LAN multiaddrs with /p2p/<pid>
+	Time      time.Time `json:"t"`
+}
+
+type signedRecord struct {
+	Record    string `json:"r"` // Base64 record JSON
+	Signature string `json:"s"` // Hex
+}
+
+// Signer signs records (AccountManager satisfies it)
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// IsLANAddr reports whether m is a private or link-local, non-loopback address
+func IsLANAddr(m multiaddr.Multiaddr) bool {
+	return !manet.IsIPLoopback(m) && manet.IsPrivateAddr(m)
+}
+
+// LANAddrs keeps the private-network addresses worth announcing
+func LANAddrs(addrs []string) []string {
+	var lan []string
+	for _, a := range addrs {
+		m, err := multiaddr.NewMultiaddr(a)
+		if err != nil || !IsLANAddr(m) {
+			continue
+		}
+		lan = append(lan, a)
+	}
+	return lan
+}
+
+// Sign serializes a record signed by the key in r.PublicKey
+func Sign(r Record, signer Signer) ([]byte, error) {
+	r.V = 1
+	r.PublicKey = strings.ToLower(r.PublicKey)
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	if len(r.Addrs) == 0 {
+		return nil, fmt.Errorf("%w: no LAN addresses", ErrInvalidRecord)
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signer.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(signedRecord{
+		Record:    base64.StdEncoding.EncodeToString(data),
+		Signature: hex.EncodeToString(sig),
+	})
+}
+
+// Open verifies a record published by fromPeer at now. The record must be
+// signed by its own key, come from the peer it names, be fresh, and carry at
+// least one LAN address; addresses outside the LAN are dropped.
+func Open(msg []byte, fromPeer peer.ID, now time.Time) (*Record, error) {
+	var signed signedRecord
+	if err := json.Unmarshal(msg, &signed); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(signed.Record)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+
+	pub, err := hex.DecodeString(r.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, ErrInvalidSig
+	}
+	sig, err := hex.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(pub, data, sig) {
+		return nil, ErrInvalidSig
+	}
+
+	if r.PeerID != fromPeer.String() {
+		return nil, fmt.Errorf("%w: published by another peer", ErrInvalidRecord)
+	}
+	if age := now.Sub(r.Time); age > MaxAge || age < -MaxAge {
+		return nil, ErrStale
+	}
+	var addrs []string
+	for _, a := range LANAddrs(r.Addrs) {
+		m, _ := multiaddr.NewMultiaddr(a)
+		if info, err := peer.AddrInfoFromP2pAddr(m); err == nil && info.ID == fromPeer {
+			addrs = append(addrs, a)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%w: no LAN addresses", ErrInvalidRecord)
+	}
+	r.Addrs = addrs
+	return &r, nil
+}
@@ -0,0 +1,73 @@
+package presence
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type testKey struct {
+	priv ed25519.PrivateKey
+}
+
+func (k testKey) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(k.priv, data), nil
+}
+
+func testPeer(t *testing.T) peer.ID {
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestSignOpen(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	pid := testPeer(t)
+	now := time.Now()
+
+	addrs := LANAddrs([]string{
+		"/ip4/192.168.1.20/tcp/4001/p2p/" + pid.String(),
+		"/ip4/8.8.8.8/tcp/4001/p2p/" + pid.String(),
+		"/ip4/127.0.0.1/tcp/4001/p2p/" + pid.String(),
+	})
+	if len(addrs) != 1 {
+		t.Fatalf("expected only the LAN address, got %v", addrs)
+	}
+
+	msg, err := Sign(Record{Name: "alice", PublicKey: hex.EncodeToString(pub), PeerID: pid.String(), Addrs: addrs, Time: now}, testKey{priv})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	r, err := Open(msg, pid, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if r.Name != "alice" || r.PublicKey != hex.EncodeToString(pub) || len(r.Addrs) != 1 {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	if _, err := Open(msg, testPeer(t), now); !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("expected ErrInvalidRecord for another publisher, got %v", err)
+	}
+	if _, err := Open(msg, pid, now.Add(MaxAge+time.Minute)); !errors.Is(err, ErrStale) {
+		t.Fatalf("expected ErrStale, got %v", err)
+	}
+
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	forged, _ := Sign(Record{Name: "mallory", PublicKey: hex.EncodeToString(pub), PeerID: pid.String(), Addrs: addrs, Time: now}, testKey{otherPriv})
+	if _, err := Open(forged, pid, now); !errors.Is(err, ErrInvalidSig) {
+		t.Fatalf("expected ErrInvalidSig, got %v", err)
+	}
+}
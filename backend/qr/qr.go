@@ -0,0 +1,120 @@
+// Package qr renders Mochi links and peer addresses as QR codes (PNG or SVG).
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ErrTooLarge means the content does not fit a version 40 symbol at the
+// error correction level tried
+var ErrTooLarge = errors.New("content too large for a QR code")
+
+// levels from most to least redundant
+var levels = []struct {
+	name  string
+	level qrcode.RecoveryLevel
+}{
+	{"H", qrcode.Highest},
+	{"Q", qrcode.High},
+	{"M", qrcode.Medium},
+	{"L", qrcode.Low},
+}
+
+// ParseLevel validates an error correction level name (L, M, Q, H). Empty means M.
+func ParseLevel(name string) (string, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return "M", nil
+	}
+	for _, l := range levels {
+		if l.name == name {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown error correction level %q", name)
+}
+
+// Code is an encoded QR symbol
+type Code struct {
+	Level   string // Level actually used; only EncodeAtOrBelow may go lower than requested
+	Version int
+	q       *qrcode.QRCode
+}
+
+// Encode builds a QR code at exactly the requested level
+func Encode(content, level string) (*Code, error) {
+	level, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range levels {
+		if l.name != level {
+			continue
+		}
+		q, err := qrcode.New(content, l.level)
+		if err != nil {
+			return nil, ErrTooLarge
+		}
+		return &Code{Level: l.name, Version: q.VersionNumber, q: q}, nil
+	}
+	return nil, ErrTooLarge
+}
+
+// EncodeAtOrBelow builds a QR code at the requested level, or failing that at
+// the most redundant lower level the content fits
+func EncodeAtOrBelow(content, level string) (*Code, error) {
+	level, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	started := false
+	for _, l := range levels {
+		if l.name == level {
+			started = true
+		}
+		if !started {
+			continue
+		}
+		q, err := qrcode.New(content, l.level)
+		if err == nil {
+			return &Code{Level: l.name, Version: q.VersionNumber, q: q}, nil
+		}
+	}
+	return nil, ErrTooLarge
+}
+
+// PNG renders the code as a size x size pixel image
+func (c *Code) PNG(size int) ([]byte, error) {
+	return c.q.PNG(size)
+}
+
+// SVG renders the code as a scalable image, one unit per module, including
+// the quiet zone
+func (c *Code) SVG() []byte {
+	bitmap := c.q.Bitmap()
+	n := len(bitmap)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// Merge horizontal runs into one rectangle
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", x, y, run, run)
+			x += run - 1
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return []byte(b.String())
+}
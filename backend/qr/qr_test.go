@@ -0,0 +1,48 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncode_PNGAndSVG(t *testing.T) {
+	code, err := Encode("mochi://eyJ2IjoxLCJjIjoiYmFmeXRlc3QifQ==", "h")
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if code.Level != "H" {
+		t.Fatalf("expected level H, got %s", code.Level)
+	}
+	png, err := code.PNG(256)
+	if err != nil || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Fatalf("PNG: %v", err)
+	}
+	svg := string(code.SVG())
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, "M") {
+		t.Fatalf("unexpected SVG %q", svg)
+	}
+}
+
+func TestEncode_FallsBackToLowerLevel(t *testing.T) {
+	// Fits version 40 at L (2953 bytes) but not at H (1273 bytes)
+	content := "mochi://" + strings.Repeat("a", 2000)
+	if _, err := Encode(content, "H"); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Encode must keep the requested level, got %v", err)
+	}
+	code, err := EncodeAtOrBelow(content, "H")
+	if err != nil {
+		t.Fatalf("EncodeAtOrBelow: %v", err)
+	}
+	if code.Level == "H" {
+		t.Fatalf("unexpected level %s version %d", code.Level, code.Version)
+	}
+
+	if _, err := EncodeAtOrBelow(strings.Repeat("a", 4000), "L"); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+	if _, err := Encode("x", "Z"); err == nil {
+		t.Fatal("expected an error for an unknown level")
+	}
+}
@@ -43,13 +43,13 @@ export const useAccountStore = defineStore('account', {
             return res.data.mnemonic;
         },
 
-        async initAccount(mnemonic: string, password: string, name: string) {
-            await api.post('/account/init', { mnemonic, password, name });
+        async initAccount(mnemonic: string, password: string, name: string, passphrase = '') {
+            await api.post('/account/init', { mnemonic, password, name, passphrase });
             await this.checkStatus();
         },
 
-        async unlock(password: string, rememberMe: boolean) {
-            await api.post('/account/unlock', { password, remember_me: rememberMe });
+        async unlock(password: string, rememberMe: boolean, passphrase = '') {
+            await api.post('/account/unlock', { password, passphrase, remember_me: rememberMe });
             await this.checkStatus();
         },
 
@@ -63,8 +63,8 @@ export const useAccountStore = defineStore('account', {
             await this.checkStatus();
         },
 
-        async exportMnemonic(password: string) {
-            const res = await api.post('/account/export', { password });
+        async exportMnemonic(password: string, passphrase = '') {
+            const res = await api.post('/account/export', { password, passphrase });
             return res.data.mnemonic;
         },
 